@@ -5,6 +5,8 @@ import (
 	"denv/internal/config"
 	"denv/internal/env"
 	"denv/internal/filehandler"
+	"denv/internal/runner"
+	"errors"
 	"fmt"
 	"os"
 )
@@ -15,9 +17,16 @@ func main() {
 	globalConfig := config.NewConfig()
 	filehandler := filehandler.NewFileHandler(globalConfig.RootDir, globalConfig.Debug)
 	userConfig := config.NewUserConfig(globalConfig, filehandler)
-	envManager := env.NewDynamicEnv(globalConfig, userConfig, filehandler)
+	projectConfig := config.NewProjectConfig(globalConfig)
+	envManager := env.NewDynamicEnv(globalConfig, userConfig, projectConfig, filehandler)
 	rootCmd := cli.NewRootCommand(version, envManager)
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	envManager.Cleanup()
+	if err != nil {
+		var exitErr *runner.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		fmt.Println(err)
 		os.Exit(1)
 	}
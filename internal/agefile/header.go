@@ -0,0 +1,141 @@
+package agefile
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+ * Reads the header of age files (https://age-encryption.org/v1) without
+ * decrypting them. Every recipient of a file has a stanza in the header:
+ *
+ * ```
+ * age-encryption.org/v1
+ * -> X25519 <ephemeral share>
+ * <wrapped file key>
+ * -> ssh-ed25519 <tag> <ephemeral share>
+ * <wrapped file key>
+ * --- <mac>
+ * ```
+ *
+ * X25519 stanzas don't identify their recipient, SSH stanzas carry a tag
+ * derived from the public key.
+ */
+
+const armorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+const armorFooter = "-----END AGE ENCRYPTED FILE-----"
+const versionLine = "age-encryption.org/v1"
+
+type Stanza struct {
+	Type string
+	Args []string
+}
+
+// Grease stanzas are added by age to keep parsers lenient and carry no recipient.
+func (s Stanza) IsGrease() bool {
+	return strings.HasSuffix(s.Type, "-grease")
+}
+
+func (s Stanza) Tag() string {
+	if (s.Type == "ssh-ed25519" || s.Type == "ssh-rsa") && len(s.Args) > 0 {
+		return s.Args[0]
+	}
+	return ""
+}
+
+type Header struct {
+	Stanzas []Stanza
+}
+
+func dearmor(data []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(text, armorHeader) {
+		return data, nil
+	}
+	if !strings.HasSuffix(text, armorFooter) {
+		return nil, errors.New("armor without footer")
+	}
+	body := strings.TrimSuffix(strings.TrimPrefix(text, armorHeader), armorFooter)
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+}
+
+func ParseHeader(data []byte) (*Header, error) {
+	data, err := dearmor(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid armor: %w", err)
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+	readLine := func() (string, error) {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", errors.New("unexpected end of header")
+		}
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+
+	line, err := readLine()
+	if err != nil || line != versionLine {
+		return nil, errors.New("not an age file")
+	}
+
+	header := &Header{}
+	line, err = readLine()
+	for err == nil {
+		if strings.HasPrefix(line, "---") {
+			return header, nil
+		}
+		if !strings.HasPrefix(line, "-> ") {
+			return nil, fmt.Errorf("invalid stanza: %q", line)
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "-> "))
+		if len(fields) == 0 {
+			return nil, errors.New("stanza without type")
+		}
+		header.Stanzas = append(header.Stanzas, Stanza{Type: fields[0], Args: fields[1:]})
+
+		// The body is wrapped at 64 columns and ends with a shorter line
+		for {
+			if line, err = readLine(); err != nil {
+				break
+			}
+			if len(line) < 64 {
+				break
+			}
+		}
+		if err == nil {
+			line, err = readLine()
+		}
+	}
+	return nil, err
+}
+
+func (h *Header) Recipients() []Stanza {
+	var stanzas []Stanza
+	for _, stanza := range h.Stanzas {
+		if !stanza.IsGrease() {
+			stanzas = append(stanzas, stanza)
+		}
+	}
+	return stanzas
+}
+
+// SSHTag returns the tag of the stanzas for an SSH public key in the
+// authorized_keys format.
+func SSHTag(publicKey string) (string, error) {
+	fields := strings.Fields(publicKey)
+	if len(fields) < 2 {
+		return "", errors.New("invalid SSH public key")
+	}
+	wire, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid SSH public key: %w", err)
+	}
+	sum := sha256.Sum256(wire)
+	return base64.RawStdEncoding.EncodeToString(sum[:4]), nil
+}
@@ -2,11 +2,12 @@ package cli
 
 import (
 	"denv/internal/env"
+	"denv/internal/ui"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
-	"os/exec"
-	"regexp"
 	"sort"
 	"strings"
 
@@ -20,7 +21,10 @@ func NewRootCommand(version string, envManager *env.DynamicEnv) *cobra.Command {
 		Version: version,
 	}
 
+	cmd.AddCommand(newInitCommand(envManager))
 	cmd.AddCommand(newRunCommand(envManager))
+	cmd.AddCommand(newUpCommand(envManager))
+	cmd.AddCommand(newTrustCommand(envManager))
 	cmd.AddCommand(newDeleteCommand(envManager))
 	cmd.AddCommand(newImportCommand(envManager))
 	cmd.AddCommand(newExportCommand(envManager))
@@ -30,64 +34,21 @@ func NewRootCommand(version string, envManager *env.DynamicEnv) *cobra.Command {
 	cmd.AddCommand(newRecipientsCommand(envManager))
 	cmd.AddCommand(newRecipientAddCommand(envManager))
 	cmd.AddCommand(newRecipientDelCommand(envManager))
+	cmd.AddCommand(newIdentityCommand(envManager))
 	cmd.AddCommand(newReindexCommand(envManager))
 	cmd.AddCommand(newReencryptAllCommand(envManager))
+	cmd.AddCommand(newInspectCommand(envManager))
 	cmd.AddCommand(newCatCommand(envManager))
-
-	return cmd
-}
-
-func newRunCommand(envManager *env.DynamicEnv) *cobra.Command {
-	var envKeys []string
-	var export bool
-
-	cmd := &cobra.Command{
-		Use:   "run",
-		Short: "Run command with environment variables",
-		Long: `Run a command with environment variables loaded from the specified keys.
-You can also export the environment variables to stdout using the --export flag.`,
-		Args: cobra.ArbitraryArgs, // Accepts any arguments after the command
-		RunE: func(cmd *cobra.Command, args []string) error {
-			osEnvKeys := strings.Split(os.Getenv("DENV_KEYS"), ",")
-			for _, key := range osEnvKeys {
-				key = strings.TrimSpace(key)
-				if key != "" {
-					envKeys = append(envKeys, key)
-				}
-			}
-
-			envVars := envManager.GetEnvs(envKeys)
-
-			if export {
-				for key, value := range envVars {
-					fmt.Printf("%s=%s\n", key, value)
-				}
-				return nil
-			}
-
-			if len(args) == 0 {
-				return errors.New("no command provided to run")
-			}
-
-			env := os.Environ()
-			for key, value := range envVars {
-				env = append(env, fmt.Sprintf("%s=%s", key, value))
-			}
-
-			command := args[0]
-			commandArgs := args[1:]
-			cmdExec := exec.Command(command, commandArgs...)
-			cmdExec.Env = env
-			cmdExec.Stdout = os.Stdout
-			cmdExec.Stderr = os.Stderr
-			cmdExec.Stdin = os.Stdin
-
-			return cmdExec.Run()
-		},
-	}
-
-	cmd.Flags().StringArrayVarP(&envKeys, "env", "e", []string{}, "Keys to load environment variables")
-	cmd.Flags().BoolVar(&export, "export", false, "Print environment variables to stdout")
+	cmd.AddCommand(newPutCommand(envManager))
+	cmd.AddCommand(newSecretCommand(envManager))
+	cmd.AddCommand(newPassphraseCommand(envManager))
+	cmd.AddCommand(newSetCommand(envManager))
+	cmd.AddCommand(newGetCommand(envManager))
+	cmd.AddCommand(newUnsetCommand(envManager))
+	cmd.AddCommand(newGenCommand(envManager))
+	cmd.AddCommand(newTOTPCommand(envManager))
+	cmd.AddCommand(newUICommand(envManager))
+	cmd.AddCommand(newDoctorCommand(version, envManager))
 
 	return cmd
 }
@@ -178,162 +139,299 @@ func newRenameCommand(envManager *env.DynamicEnv) *cobra.Command {
 		Short: "Rename a key",
 		Args:  cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			key := args[0]
-			newName := args[1]
-			parsed, err := envManager.GetEnv(key)
-			if err != nil {
-				return err
-			}
-			return envManager.SetEnv(newName, parsed)
+			return envManager.RenameEnv(args[0], args[1])
 		},
 	}
 }
 
-func sanitizeKeyForFilename(key string) string {
-	re := regexp.MustCompile(`[^\w.-]`)
-	return re.ReplaceAllString(key, "_")
+func newReindexCommand(envManager *env.DynamicEnv) *cobra.Command {
+	return &cobra.Command{
+		Use:   "reindex",
+		Short: "Rebuild index for all data",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return envManager.BuildIndex()
+		},
+	}
 }
 
-func newEditCommand(envManager *env.DynamicEnv) *cobra.Command {
+func newReencryptAllCommand(envManager *env.DynamicEnv) *cobra.Command {
 	return &cobra.Command{
-		Use:   "edit <key>",
-		Short: "Edit the value of a key with $EDITOR",
+		Use:   "reencryptAll",
+		Short: "Reencrypt all data",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			skipped, err := envManager.ReencryptAll()
+			if len(skipped) > 0 {
+				fmt.Printf("Skipped %d files that can't be decrypted with your identities: %s\n", len(skipped), strings.Join(skipped, ", "))
+			}
+			return err
+		},
+	}
+}
+
+func newCatCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var raw bool
+	var payload bool
+	var data bool
+
+	cmd := &cobra.Command{
+		Use:   "cat <key>",
+		Short: "Show the value of a key",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			key := args[0]
 
-			editor := os.Getenv("EDITOR")
-			if editor == "" {
-				return errors.New("$EDITOR is not set")
-			}
-
 			parsed, err := envManager.GetEnv(key)
 			if err != nil {
-				fmt.Println("Editing new env")
+				return fmt.Errorf("failed to retrieve key: %w", err)
 			}
 
-			var metadata env.DynamicEnvMetadata
-			oldValue := ""
-			if parsed != nil {
-				metadata = parsed.Metadata
-				value, err := envManager.FormatValue(parsed, false)
-				if err != nil {
-					return fmt.Errorf("failed to format value: %w", err)
-				}
-				oldValue = value
+			if payload {
+				_, err := os.Stdout.WriteString(parsed.Payload)
+				return err
+			}
+			if data {
+				_, err := os.Stdout.WriteString(parsed.Raw)
+				return err
 			}
 
-			safeKey := sanitizeKeyForFilename(key)
-			tempFile, err := os.CreateTemp("", fmt.Sprintf("%s-*.yml", safeKey))
+			value, err := envManager.FormatValue(parsed, false)
 			if err != nil {
-				return fmt.Errorf("failed to create temporary file: %w", err)
+				return fmt.Errorf("failed to format value: %w", err)
 			}
-			defer os.Remove(tempFile.Name())
 
-			if _, err := tempFile.WriteString(oldValue); err != nil {
-				return fmt.Errorf("failed to write to temporary file: %w", err)
+			if raw {
+				_, err := os.Stdout.WriteString(value)
+				return err
 			}
-			tempFile.Close()
+			fmt.Println(value)
+			return nil
+		},
+	}
 
-			cmdExec := exec.Command(editor, tempFile.Name())
-			cmdExec.Stdout = os.Stdout
-			cmdExec.Stderr = os.Stderr
-			cmdExec.Stdin = os.Stdin
+	cmd.Flags().BoolVar(&raw, "raw", false, "Print the exact document without a trailing newline")
+	cmd.Flags().BoolVar(&payload, "payload", false, "Print the exact bytes of the payload only")
+	cmd.Flags().BoolVar(&data, "data", false, "Print the data section only")
+	cmd.MarkFlagsMutuallyExclusive("raw", "payload", "data")
 
-			if err := cmdExec.Run(); err != nil {
-				return fmt.Errorf("failed to open editor: %w", err)
-			}
+	return cmd
+}
 
-			newValueBytes, err := os.ReadFile(tempFile.Name())
-			if err != nil {
-				return fmt.Errorf("failed to read temporary file: %w", err)
-			}
-			newValue := string(newValueBytes)
+func newPutCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var payload bool
 
-			if newValue == "" || newValue == oldValue {
-				fmt.Println("No changes made.")
-				return nil
-			}
+	cmd := &cobra.Command{
+		Use:   "put <key>",
+		Short: "Write the value of a key from stdin",
+		Long: `Write the value of a key from stdin, replacing the whole document.
+With --payload, only the payload is replaced with the exact bytes from stdin, which works for binary files.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key := args[0]
 
-			parsed, err = envManager.ParseRawValue(newValue, false)
+			input, err := io.ReadAll(os.Stdin)
 			if err != nil {
-				return fmt.Errorf("failed to parse new value: %w", err)
+				return fmt.Errorf("failed to read stdin: %w", err)
 			}
-			parsed.Metadata = metadata
 
-			if err := envManager.SetEnv(key, parsed); err != nil {
-				return fmt.Errorf("failed to save updated value: %w", err)
+			parsed, err := envManager.GetEnv(key)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("failed to retrieve key: %w", err)
 			}
 
-			fmt.Println("Updated key:", key)
-			return nil
+			var value *env.DynamicEnvValue
+			if payload {
+				value = parsed
+				if value == nil {
+					value = &env.DynamicEnvValue{}
+				}
+				value.Payload = string(input)
+			} else {
+				value, err = envManager.ParseRawValue(string(input), false)
+				if err != nil {
+					return fmt.Errorf("failed to parse value: %w", err)
+				}
+				if parsed != nil {
+					value.Metadata = parsed.Metadata
+				}
+			}
+
+			return envManager.SetEnv(key, value)
 		},
 	}
+
+	cmd.Flags().BoolVar(&payload, "payload", false, "Replace the payload only")
+
+	return cmd
 }
 
-func newRecipientsCommand(envManager *env.DynamicEnv) *cobra.Command {
+func newSecretCommand(envManager *env.DynamicEnv) *cobra.Command {
 	return &cobra.Command{
-		Use:   "recipients",
-		Short: "List all recipients",
+		Use:   "secret <key> [variables...]",
+		Short: "Mark the variables of a key that are secret",
+		Long: `Mark the variables of a key that are secret, e.g. to be redacted by run --redact.
+Without variables, the list is shown. Use "--" alone to reset it so that all variables are secret.`,
+		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			recipients := envManager.UserConfig.Data.Recipients
-			for _, recipient := range recipients {
-				fmt.Println(recipient)
+			key := args[0]
+			parsed, err := envManager.GetEnv(key)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve key: %w", err)
 			}
-			return nil
+
+			if len(args) == 1 && cmd.ArgsLenAtDash() < 0 {
+				if len(parsed.Metadata.Secret) == 0 {
+					fmt.Println("All variables are secret")
+				}
+				for _, name := range parsed.Metadata.Secret {
+					fmt.Println(name)
+				}
+				return nil
+			}
+
+			parsed.Metadata.Secret = args[1:]
+			return envManager.SetEnv(key, parsed)
 		},
 	}
 }
 
-func newRecipientAddCommand(envManager *env.DynamicEnv) *cobra.Command {
-	return &cobra.Command{
-		Use:   "recipientAdd <recipient>",
-		Short: "Add a recipient",
-		Args:  cobra.ExactArgs(1),
+func newPassphraseCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var off bool
+
+	cmd := &cobra.Command{
+		Use:   "passphrase <key>",
+		Short: "Encrypt a key with a passphrase instead of the recipients",
+		Long: `Encrypt a key with a passphrase instead of the recipients, e.g. for break-glass secrets.
+The passphrase is asked for on the terminal whenever the key is read or written.
+Passphrase protected keys are skipped by reindex and reencryptAll.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			recipient := args[0]
-			return envManager.UserConfig.AddRecipient(recipient)
+			key := args[0]
+			parsed, err := envManager.GetEnv(key)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve key: %w", err)
+			}
+			parsed.Metadata.Passphrase = !off
+			if err := envManager.SetEnv(key, parsed); err != nil {
+				return err
+			}
+			if off {
+				fmt.Println("Encrypted", key, "to its recipients")
+			} else {
+				fmt.Println("Encrypted", key, "with a passphrase")
+			}
+			return nil
 		},
 	}
+
+	cmd.Flags().BoolVar(&off, "off", false, "Encrypt the key to its recipients again")
+
+	return cmd
 }
 
-func newRecipientDelCommand(envManager *env.DynamicEnv) *cobra.Command {
-	return &cobra.Command{
-		Use:   "recipientDel <recipient>",
-		Short: "Remove a recipient",
-		Args:  cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			recipient := args[0]
-			return envManager.UserConfig.RemoveRecipient(recipient)
-		},
+func variableSection(local bool) string {
+	if local {
+		return "local"
 	}
+	return "env"
 }
 
-func newReindexCommand(envManager *env.DynamicEnv) *cobra.Command {
-	return &cobra.Command{
-		Use:   "reindex",
-		Short: "Rebuild index for all data",
+func newSetCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var local bool
+	var stdin bool
+
+	cmd := &cobra.Command{
+		Use:   "set <key> <VAR=value>... | set <key> <VAR> --stdin",
+		Short: "Set variables of a key",
+		Long: `Set variables of a key, creating the key if it does not exist.
+Use --stdin to read the value from stdin so that it does not show up in the shell history.`,
+		Args: cobra.MinimumNArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return envManager.BuildIndex()
+			key := args[0]
+
+			values := make([][2]string, 0, len(args)-1)
+			if stdin {
+				if len(args) != 2 {
+					return errors.New("only one variable can be read from stdin")
+				}
+				data, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					return fmt.Errorf("failed to read stdin: %w", err)
+				}
+				value := strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+				values = append(values, [2]string{args[1], value})
+			} else {
+				for _, arg := range args[1:] {
+					parts := strings.SplitN(arg, "=", 2)
+					if len(parts) != 2 || parts[0] == "" {
+						return fmt.Errorf("invalid assignment: %s", arg)
+					}
+					values = append(values, [2]string{parts[0], parts[1]})
+				}
+			}
+
+			parsed, err := envManager.GetEnv(key)
+			if errors.Is(err, fs.ErrNotExist) {
+				parsed = &env.DynamicEnvValue{}
+			} else if err != nil {
+				return fmt.Errorf("failed to retrieve key: %w", err)
+			}
+
+			for _, value := range values {
+				if err := parsed.SetVariable(variableSection(local), value[0], value[1]); err != nil {
+					return fmt.Errorf("failed to set %s: %w", value[0], err)
+				}
+			}
+			return envManager.SetEnv(key, parsed)
 		},
 	}
+
+	cmd.Flags().BoolVar(&local, "local", false, "Set local variables instead of environment variables")
+	cmd.Flags().BoolVar(&stdin, "stdin", false, "Read the value from stdin")
+
+	return cmd
 }
 
-func newReencryptAllCommand(envManager *env.DynamicEnv) *cobra.Command {
-	return &cobra.Command{
-		Use:   "reencryptAll",
-		Short: "Reencrypt all data",
+func newGetCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var local bool
+
+	cmd := &cobra.Command{
+		Use:   "get <key> <VAR>",
+		Short: "Show the value of a variable",
+		Args:  cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return envManager.ReencryptAll()
+			key := args[0]
+			name := args[1]
+
+			parsed, err := envManager.GetEnv(key)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve key: %w", err)
+			}
+
+			value, ok, err := parsed.GetVariable(variableSection(local), name)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("variable not found: %s", name)
+			}
+
+			fmt.Println(value)
+			return nil
 		},
 	}
+
+	cmd.Flags().BoolVar(&local, "local", false, "Get local variables instead of environment variables")
+
+	return cmd
 }
 
-func newCatCommand(envManager *env.DynamicEnv) *cobra.Command {
-	return &cobra.Command{
-		Use:   "cat <key>",
-		Short: "Show the value of a key",
-		Args:  cobra.ExactArgs(1),
+func newUnsetCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var local bool
+
+	cmd := &cobra.Command{
+		Use:   "unset <key> <VAR>...",
+		Short: "Remove variables from a key",
+		Args:  cobra.MinimumNArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			key := args[0]
 
@@ -342,13 +440,35 @@ func newCatCommand(envManager *env.DynamicEnv) *cobra.Command {
 				return fmt.Errorf("failed to retrieve key: %w", err)
 			}
 
-			value, err := envManager.FormatValue(parsed, false)
-			if err != nil {
-				return fmt.Errorf("failed to format value: %w", err)
+			for _, name := range args[1:] {
+				found, err := parsed.UnsetVariable(variableSection(local), name)
+				if err != nil {
+					return fmt.Errorf("failed to unset %s: %w", name, err)
+				}
+				if !found {
+					return fmt.Errorf("variable not found: %s", name)
+				}
 			}
+			return envManager.SetEnv(key, parsed)
+		},
+	}
 
-			fmt.Println(value)
-			return nil
+	cmd.Flags().BoolVar(&local, "local", false, "Remove local variables instead of environment variables")
+
+	return cmd
+}
+
+func newUICommand(envManager *env.DynamicEnv) *cobra.Command {
+	return &cobra.Command{
+		Use:   "ui",
+		Short: "Browse and manage keys in a terminal UI",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ui.Run(envManager, ui.Actions{
+				Edit: func(key string) error {
+					return editKey(envManager, key, false)
+				},
+			})
 		},
 	}
 }
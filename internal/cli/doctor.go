@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"denv/internal/env"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/spf13/cobra"
+)
+
+type doctorReport struct {
+	Version string      `json:"version"`
+	OS      string      `json:"os"`
+	Arch    string      `json:"arch"`
+	Checks  []env.Check `json:"checks"`
+	Failed  int         `json:"failed"`
+	Warned  int         `json:"warned"`
+}
+
+func newDoctorCommand(version string, envManager *env.DynamicEnv) *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the environment denv runs in",
+		Long: `Check that age and age-keygen are installed, that the identities can be read and
+match a recipient, that config.yml has valid recipients and that the store is not writable
+by other users. Use --json for a report to attach to support tickets, it contains no secrets.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report := doctorReport{Version: version, OS: runtime.GOOS, Arch: runtime.GOARCH, Checks: envManager.Doctor()}
+			for _, check := range report.Checks {
+				switch check.Status {
+				case env.CheckFail:
+					report.Failed++
+				case env.CheckWarn:
+					report.Warned++
+				}
+			}
+
+			if asJSON {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				encoder.SetEscapeHTML(false)
+				if err := encoder.Encode(report); err != nil {
+					return err
+				}
+			} else {
+				for _, check := range report.Checks {
+					fmt.Printf("[%s] %s: %s\n", check.Status, check.Name, check.Message)
+					if check.Fix != "" {
+						fmt.Printf("       fix: %s\n", check.Fix)
+					}
+				}
+			}
+
+			if report.Failed > 0 {
+				return fmt.Errorf("%d of %d checks failed", report.Failed, len(report.Checks))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the report as JSON")
+
+	return cmd
+}
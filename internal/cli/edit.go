@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"denv/internal/diff"
+	"denv/internal/env"
+	"denv/internal/prompt"
+	"denv/internal/tmpfs"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+const editorErrorPrefix = "# denv: "
+
+func sanitizeKeyForFilename(key string) string {
+	re := regexp.MustCompile(`[^\w.-]`)
+	return re.ReplaceAllString(key, "_")
+}
+
+func editorCommand(file string) (*exec.Cmd, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		return nil, errors.New("neither $VISUAL nor $EDITOR is set")
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		args := append(strings.Fields(editor), file)
+		cmd = exec.Command(args[0], args[1:]...)
+	} else {
+		// Let the shell split editors with arguments, e.g. `code -w`
+		cmd = exec.Command("sh", "-c", editor+` "$@"`, editor, file)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+func withEditorError(content string, err error) string {
+	var builder strings.Builder
+	for _, line := range strings.Split(err.Error(), "\n") {
+		builder.WriteString(editorErrorPrefix + line + "\n")
+	}
+	builder.WriteString(editorErrorPrefix + "fix the error and save again, or clear the file to abort\n")
+	return builder.String() + content
+}
+
+func stripEditorErrors(content string) string {
+	for strings.HasPrefix(content, editorErrorPrefix) {
+		i := strings.Index(content, "\n")
+		if i < 0 {
+			return ""
+		}
+		content = content[i+1:]
+	}
+	return content
+}
+
+func runEditor(file string, content string) (string, error) {
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		return "", fmt.Errorf("failed to write to temporary file: %w", err)
+	}
+
+	cmdExec, err := editorCommand(file)
+	if err != nil {
+		return "", err
+	}
+	if err := cmdExec.Run(); err != nil {
+		return "", fmt.Errorf("failed to open editor: %w", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read temporary file: %w", err)
+	}
+	return stripEditorErrors(string(data)), nil
+}
+
+func editKey(envManager *env.DynamicEnv, key string, yes bool) error {
+	parsed, err := envManager.GetEnv(key)
+	if errors.Is(err, fs.ErrNotExist) {
+		parsed = nil
+		fmt.Println("Editing new env")
+	} else if err != nil {
+		return fmt.Errorf("failed to retrieve key: %w", err)
+	}
+
+	var metadata env.DynamicEnvMetadata
+	revision := ""
+	oldValue := ""
+	if parsed != nil {
+		if !utf8.ValidString(parsed.Payload) {
+			return errors.New("payload is binary, use put --payload to replace it")
+		}
+		metadata = parsed.Metadata
+		revision = parsed.Revision
+		value, err := envManager.FormatValue(parsed, false)
+		if err != nil {
+			return fmt.Errorf("failed to format value: %w", err)
+		}
+		oldValue = value
+	}
+
+	dir, err := tmpfs.MkdirPrivate("denv-edit-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer tmpfs.ShredAll(dir)
+	file := filepath.Join(dir, sanitizeKeyForFilename(key)+".yml")
+
+	content := oldValue
+	openEditor := true
+	for {
+		newValue := content
+		if openEditor {
+			newValue, err = runEditor(file, content)
+			if err != nil {
+				return err
+			}
+		}
+		openEditor = true
+
+		if newValue == "" || newValue == oldValue {
+			fmt.Println("No changes made.")
+			return nil
+		}
+
+		if diff.HasConflicts(newValue) {
+			content = withEditorError(newValue, errors.New("resolve the conflict markers"))
+			continue
+		}
+
+		parsed, err = envManager.ParseRawValue(newValue, false)
+		if err != nil {
+			content = withEditorError(newValue, err)
+			continue
+		}
+		parsed.Metadata = metadata
+		parsed.Revision = revision
+
+		if !yes {
+			fmt.Print(diff.Format(diff.Lines(diff.SplitLines(oldValue), diff.SplitLines(newValue)), 2))
+			if !prompt.Confirm("Save changes to " + key + "?") {
+				fmt.Println("Discarded changes.")
+				return nil
+			}
+		}
+
+		err = envManager.SetEnv(key, parsed)
+		var conflict *env.ConflictError
+		if !errors.As(err, &conflict) {
+			if err != nil {
+				return fmt.Errorf("failed to save updated value: %w", err)
+			}
+			break
+		}
+
+		// Someone else saved the key in the meantime, merge their changes
+		current, err := envManager.GetEnv(key)
+		if err != nil {
+			return fmt.Errorf("key was changed and can't be read: %w", err)
+		}
+		theirs, err := envManager.FormatValue(current, false)
+		if err != nil {
+			return fmt.Errorf("failed to format value: %w", err)
+		}
+		merged, clean := diff.Merge3(oldValue, newValue, theirs)
+		oldValue = theirs
+		metadata = current.Metadata
+		revision = current.Revision
+		content = merged
+
+		if !clean {
+			fmt.Println("The key was changed since it was opened, resolve the conflicts in the editor.")
+			continue
+		}
+		fmt.Println("The key was changed since it was opened, your changes were merged.")
+		openEditor = !prompt.Confirm("Use the merged result without editing?")
+	}
+
+	fmt.Println("Updated key:", key)
+	return nil
+}
+
+func newEditCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "edit <key>",
+		Short: "Edit the value of a key with $VISUAL or $EDITOR",
+		Long: `Edit the value of a key with $VISUAL or $EDITOR.
+The decrypted value is kept in a private, memory-backed directory when available and shredded afterwards.
+If the new value can't be parsed, the editor is reopened with the error on top.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return editKey(envManager, args[0], yes)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Save without showing the changes and asking for confirmation")
+
+	return cmd
+}
@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"denv/internal/env"
+	"denv/internal/secretgen"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type genOptions struct {
+	length     int
+	charset    string
+	words      int
+	separator  string
+	hex        int
+	base64     int
+	uuid       bool
+	sshEd25519 bool
+	age        bool
+	comment    string
+	local      bool
+	force      bool
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func charsetNames() string {
+	names := make([]string, 0, len(secretgen.Charsets))
+	for name := range secretgen.Charsets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// generate returns the variables to set and the public part to print, if any.
+func generate(name string, key string, options genOptions, cmd *cobra.Command) ([][2]string, string, error) {
+	modes := 0
+	for _, flag := range []string{"words", "hex", "base64", "uuid", "ssh-ed25519", "age"} {
+		if cmd.Flags().Changed(flag) {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return nil, "", errors.New("only one of --words, --hex, --base64, --uuid, --ssh-ed25519 and --age can be used")
+	}
+
+	var value string
+	var err error
+	switch {
+	case cmd.Flags().Changed("words"):
+		value, err = secretgen.Passphrase(options.words, options.separator)
+	case cmd.Flags().Changed("hex"):
+		value, err = secretgen.Hex(options.hex)
+	case cmd.Flags().Changed("base64"):
+		value, err = secretgen.Base64(options.base64)
+	case options.uuid:
+		value, err = secretgen.UUID()
+	case options.sshEd25519:
+		comment := options.comment
+		if comment == "" {
+			comment = key
+		}
+		private, public, err := secretgen.SSHEd25519(comment)
+		if err != nil {
+			return nil, "", err
+		}
+		return [][2]string{{name, private}, {name + "_PUB", public}}, public, nil
+	case options.age:
+		identity, recipient, err := secretgen.AgeIdentity()
+		if err != nil {
+			return nil, "", err
+		}
+		return [][2]string{{name, identity}, {name + "_PUB", recipient}}, recipient, nil
+	default:
+		charset, ok := secretgen.Charsets[options.charset]
+		if !ok {
+			if !strings.HasPrefix(options.charset, "custom:") {
+				return nil, "", fmt.Errorf("unknown charset %q, use one of %s or custom:<characters>", options.charset, charsetNames())
+			}
+			charset = strings.TrimPrefix(options.charset, "custom:")
+		}
+		value, err = secretgen.Password(options.length, charset)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return [][2]string{{name, value}}, "", nil
+}
+
+func newGenCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var options genOptions
+
+	cmd := &cobra.Command{
+		Use:   "gen <key> <VAR>",
+		Short: "Generate a secret into a variable of a key",
+		Long: `Generate a secret into a variable of a key, creating the key if it does not exist.
+The secret is written straight into the key and never printed. Key pairs are stored
+in VAR and VAR_PUB, and the public key is printed.`,
+		Example: `  denv gen prod/db PASSWORD --length 40
+  denv gen prod/db PASSPHRASE --words 6 --separator -
+  denv gen prod/api SESSION_SECRET --hex 32
+  denv gen prod/deploy SSH_KEY --ssh-ed25519`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, name := args[0], args[1]
+			section := variableSection(options.local)
+
+			parsed, err := envManager.GetEnv(key)
+			if errors.Is(err, fs.ErrNotExist) {
+				parsed = &env.DynamicEnvValue{}
+			} else if err != nil {
+				return fmt.Errorf("failed to retrieve key: %w", err)
+			}
+
+			values, public, err := generate(name, key, options, cmd)
+			if err != nil {
+				return fmt.Errorf("failed to generate secret: %w", err)
+			}
+
+			if !options.force {
+				for _, value := range values {
+					_, exists, err := parsed.GetVariable(section, value[0])
+					if err != nil {
+						return err
+					}
+					if exists {
+						return fmt.Errorf("%s is already set, use --force to replace it", value[0])
+					}
+				}
+			}
+
+			for _, value := range values {
+				if err := parsed.SetVariable(section, value[0], value[1]); err != nil {
+					return fmt.Errorf("failed to set %s: %w", value[0], err)
+				}
+			}
+			// An explicit list of secrets has to include the new one to be redacted
+			if len(parsed.Metadata.Secret) > 0 && !containsString(parsed.Metadata.Secret, name) {
+				parsed.Metadata.Secret = append(parsed.Metadata.Secret, name)
+			}
+			if err := envManager.SetEnv(key, parsed); err != nil {
+				return err
+			}
+
+			if public != "" {
+				fmt.Println(public)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&options.length, "length", 32, "Length of the generated password")
+	cmd.Flags().StringVar(&options.charset, "charset", "alnum", "Characters of the generated password: "+charsetNames()+" or custom:<characters>")
+	cmd.Flags().IntVar(&options.words, "words", 6, "Generate a passphrase with the given number of words")
+	cmd.Flags().StringVar(&options.separator, "separator", " ", "Separator between the words of a passphrase")
+	cmd.Flags().IntVar(&options.hex, "hex", 32, "Generate the given number of random bytes, hex encoded")
+	cmd.Flags().IntVar(&options.base64, "base64", 32, "Generate the given number of random bytes, base64 encoded")
+	cmd.Flags().BoolVar(&options.uuid, "uuid", false, "Generate a random UUID")
+	cmd.Flags().BoolVar(&options.sshEd25519, "ssh-ed25519", false, "Generate an ed25519 SSH key pair into VAR and VAR_PUB")
+	cmd.Flags().BoolVar(&options.age, "age", false, "Generate an age identity into VAR and its recipient into VAR_PUB")
+	cmd.Flags().StringVar(&options.comment, "comment", "", "Comment of the SSH public key, defaults to the key")
+	cmd.Flags().BoolVar(&options.local, "local", false, "Set a local variable instead of an environment variable")
+	cmd.Flags().BoolVarP(&options.force, "force", "f", false, "Replace the variable if it is already set")
+
+	return cmd
+}
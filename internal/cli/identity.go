@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"denv/internal/env"
+	"denv/internal/shamir"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func newIdentityCommand(envManager *env.DynamicEnv) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "identity",
+		Short: "Manage the identity of this machine",
+	}
+
+	cmd.AddCommand(newIdentityRotateCommand(envManager))
+	cmd.AddCommand(newIdentitySplitCommand(envManager))
+	cmd.AddCommand(newIdentityCombineCommand())
+
+	return cmd
+}
+
+func newIdentityRotateCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var abort bool
+
+	cmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Replace the identity and its recipient",
+		Long: `Generate a new identity, add its recipient, encrypt all keys to both recipients,
+verify that every file decrypts with the new identity, archive the old identity and
+remove the old recipient. Each step is saved, run the command again to resume an
+interrupted rotation.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rotation, err := envManager.LoadRotation()
+			if err != nil {
+				return err
+			}
+
+			if abort {
+				if rotation == nil {
+					return fmt.Errorf("no rotation in progress")
+				}
+				if err := envManager.AbortRotation(rotation); err != nil {
+					return fmt.Errorf("failed to abort rotation: %w", err)
+				}
+				fmt.Println("Aborted rotation, the new recipient was removed")
+				return nil
+			}
+
+			if rotation == nil {
+				if rotation, err = envManager.StartRotation(); err != nil {
+					return err
+				}
+				fmt.Println("Generated new identity for", rotation.NewRecipient)
+			} else {
+				fmt.Printf("Resuming rotation started at %s after step %s\n", rotation.Started.Local().Format("2006-01-02 15:04"), rotation.Step)
+			}
+
+			for rotation.Step != env.RotationDone {
+				message, err := envManager.ContinueRotation(rotation)
+				if err != nil {
+					return fmt.Errorf("rotation stopped after step %s, run the command again to resume: %w", rotation.Step, err)
+				}
+				fmt.Println(message)
+			}
+			fmt.Println("Rotated identity, the old one is archived in", rotation.Archive)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&abort, "abort", false, "Abort a rotation before the new identity is installed")
+
+	return cmd
+}
+
+// writePrivateFile writes a file readable only by the user, without
+// overwriting an existing one.
+func writePrivateFile(file string, data []byte) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func newIdentitySplitCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var shares int
+	var threshold int
+	var identityFile string
+	var outDir string
+
+	cmd := &cobra.Command{
+		Use:   "split --shares N --threshold K",
+		Short: "Split the identity file into shares, any K of them rebuild it",
+		Long: `Split the identity file with Shamir's secret sharing into N shares. Any K shares
+rebuild the identity with "identity combine", fewer reveal nothing about it. The shares
+are printed as text with checksums, to be kept on paper by different people.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if identityFile == "" {
+				identityFile = envManager.Config.Identities
+			}
+			identity, err := os.ReadFile(identityFile)
+			if err != nil {
+				return fmt.Errorf("failed to read identity: %w", err)
+			}
+			parts, err := shamir.SplitText(identity, shares, threshold)
+			if err != nil {
+				return err
+			}
+
+			if outDir == "" {
+				for i, part := range parts {
+					if i > 0 {
+						fmt.Println()
+					}
+					fmt.Print(part.Encode())
+				}
+			} else {
+				if err := os.MkdirAll(outDir, 0700); err != nil {
+					return err
+				}
+				for _, part := range parts {
+					file := filepath.Join(outDir, fmt.Sprintf("share-%d-of-%d.txt", part.X, part.Total))
+					if err := writePrivateFile(file, []byte(part.Encode())); err != nil {
+						return fmt.Errorf("failed to write share: %w", err)
+					}
+					fmt.Println("Wrote", file)
+				}
+			}
+			fmt.Fprintf(os.Stderr, "Split %s into %d shares, any %d of them rebuild it. Give each share to a different person.\n", identityFile, shares, threshold)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&shares, "shares", "n", 0, "Number of shares")
+	cmd.Flags().IntVarP(&threshold, "threshold", "k", 0, "Number of shares needed to rebuild the identity")
+	cmd.Flags().StringVar(&identityFile, "identity", "", "Identity file to split instead of the identities file")
+	cmd.Flags().StringVarP(&outDir, "out-dir", "o", "", "Write each share to a file in this directory")
+	cmd.MarkFlagRequired("shares")
+	cmd.MarkFlagRequired("threshold")
+
+	return cmd
+}
+
+func newIdentityCombineCommand() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "combine [share-file...]",
+		Short: "Rebuild an identity from shares",
+		Long: `Rebuild an identity split with "identity split" from enough of its shares. Shares are
+read from the files, or from stdin, and typos are reported with their line.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var texts []string
+			if len(args) == 0 {
+				data, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					return err
+				}
+				texts = append(texts, string(data))
+			}
+			for _, file := range args {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					return err
+				}
+				texts = append(texts, string(data))
+			}
+
+			parts, err := shamir.DecodeText(strings.Join(texts, "\n"))
+			if err != nil {
+				return err
+			}
+			identity, err := shamir.CombineText(parts)
+			if err != nil {
+				return err
+			}
+
+			if output == "" {
+				os.Stdout.Write(identity)
+			} else if err := writePrivateFile(output, identity); err != nil {
+				return fmt.Errorf("failed to write identity: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "Rebuilt identity from %d shares\n", len(parts))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the identity to a new file instead of stdout")
+
+	return cmd
+}
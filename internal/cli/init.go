@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"denv/internal/config"
+	"denv/internal/env"
+	"denv/internal/secretgen"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+)
+
+func cloneStore(envManager *env.DynamicEnv, url string) error {
+	root := envManager.Config.RootDir
+	if entries, err := os.ReadDir(root); err == nil && len(entries) > 0 {
+		return fmt.Errorf("can't clone into %s, the directory is not empty", root)
+	}
+	cmd := exec.Command("git", "clone", url, root)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to clone %s: %w", url, err)
+	}
+	if err := envManager.UserConfig.LoadUserConfig(); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to load the configuration of the store: %w", err)
+	}
+	return nil
+}
+
+func setupIdentity(envManager *env.DynamicEnv, importFile string) error {
+	identities := envManager.Config.Identities
+	switch {
+	case importFile != "":
+		data, err := os.ReadFile(importFile)
+		if err != nil {
+			return fmt.Errorf("failed to read identity: %w", err)
+		}
+		if err := envManager.WriteIdentity(string(data)); err != nil {
+			return err
+		}
+		fmt.Printf("Imported identity from %s to %s\n", importFile, identities)
+	case envManager.HasIdentity():
+		fmt.Println("Using existing identity")
+	default:
+		identity, _, err := secretgen.AgeIdentity()
+		if err != nil {
+			return err
+		}
+		if err := envManager.WriteIdentity(identity); err != nil {
+			return err
+		}
+		fmt.Printf("Generated identity in %s, back it up somewhere safe\n", identities)
+	}
+	envManager.UseIdentityFile()
+	return nil
+}
+
+func newInitCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var identityFile string
+	var cloneURL string
+	var name string
+	var email string
+
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Set up an identity and the store on this machine",
+		Long: `Generate an identity, or import one with --identity, add its recipient to config.yml
+and check that data encrypted to it can be decrypted. An existing identity is reused.
+With --clone, an existing store is cloned into DENV_ROOT first. Its keys can only be read
+after another recipient ran reencryptAll.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cloneURL != "" {
+				if err := cloneStore(envManager, cloneURL); err != nil {
+					return err
+				}
+			}
+			if err := setupIdentity(envManager, identityFile); err != nil {
+				return err
+			}
+			if err := envManager.SecurePermissions(); err != nil {
+				return fmt.Errorf("failed to set permissions: %w", err)
+			}
+
+			recipient, err := envManager.IdentityRecipient()
+			if err != nil {
+				return fmt.Errorf("failed to derive recipient: %w", err)
+			}
+			fmt.Println("Recipient:", recipient)
+
+			if envManager.UserConfig.FindRecipient(recipient) != nil {
+				fmt.Println("Recipient is already in config.yml")
+			} else {
+				others := len(envManager.UserConfig.Data.Recipients)
+				if err := envManager.UserConfig.AddRecipient(config.Recipient{Key: recipient, Name: name, Email: email}); err != nil {
+					return fmt.Errorf("failed to add recipient: %w", err)
+				}
+				fmt.Println("Added recipient to config.yml")
+				if others > 0 {
+					fmt.Println("Existing keys are not encrypted to it yet, ask another recipient to run reencryptAll")
+				}
+			}
+
+			if err := envManager.CheckRoundTrip(recipient); err != nil {
+				return fmt.Errorf("round trip check failed: %w", err)
+			}
+			fmt.Println("Round trip check passed, denv is ready in", envManager.Config.RootDir)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&identityFile, "identity", "", "Import an age identity or SSH private key instead of generating one")
+	cmd.Flags().StringVar(&cloneURL, "clone", "", "Clone an existing store with git")
+	cmd.Flags().StringVar(&name, "name", "", "Name of the recipient")
+	cmd.Flags().StringVar(&email, "email", "", "Email of the recipient")
+
+	return cmd
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"denv/internal/env"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func summarizeStanzas(inspection *env.Inspection) string {
+	counts := make(map[string]int)
+	var tags []string
+	for _, stanza := range inspection.Stanzas {
+		if tag := stanza.Tag(); tag != "" {
+			tags = append(tags, stanza.Type+" "+tag)
+		} else {
+			counts[stanza.Type]++
+		}
+	}
+	var parts []string
+	for stanzaType, count := range counts {
+		parts = append(parts, fmt.Sprintf("%s ×%d", stanzaType, count))
+	}
+	sort.Strings(parts)
+	return strings.Join(append(parts, tags...), ", ")
+}
+
+func inspectionDetails(inspection *env.Inspection) string {
+	if inspection.Err != nil {
+		return inspection.Err.Error()
+	}
+	var details []string
+	if len(inspection.Missing) > 0 {
+		details = append(details, "missing "+strings.Join(inspection.Missing, ", "))
+	}
+	if len(inspection.Extra) > 0 {
+		details = append(details, "extra "+strings.Join(inspection.Extra, ", "))
+	}
+	if inspection.Passphrase {
+		details = append(details, "passphrase protected")
+	}
+	if inspection.Status == env.InspectUnindexed {
+		details = append(details, "run reindex")
+	}
+	return strings.Join(details, "; ")
+}
+
+func newInspectCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "inspect <key> | --all",
+		Short: "Compare the recipients of encrypted files with the configuration",
+		Long: `Read the age headers of encrypted files, without decrypting them, and compare them
+with the configured recipients of each key. Files are flagged as over-shared when they have
+more recipients than configured, under-shared when they have fewer, and stale when recipients
+were replaced. X25519 recipients can't be identified from the header and are compared by count.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if all && len(args) > 0 || !all && len(args) != 1 {
+				return errors.New("specify a key or --all")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var inspections []*env.Inspection
+			if all {
+				var err error
+				if inspections, err = envManager.InspectAll(); err != nil {
+					return fmt.Errorf("failed to list keys: %w", err)
+				}
+			} else {
+				inspection, err := envManager.InspectEnv(args[0])
+				if err != nil {
+					return err
+				}
+				inspections = append(inspections, inspection)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "KEY\tSTANZAS\tSTATUS\tDETAILS")
+			flagged := 0
+			for _, inspection := range inspections {
+				key := inspection.Key
+				if key == "" {
+					key = inspection.UID
+				}
+				if inspection.Status != env.InspectOK {
+					flagged++
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", key, orDash(summarizeStanzas(inspection)), inspection.Status, inspectionDetails(inspection))
+			}
+			w.Flush()
+
+			if flagged > 0 {
+				return fmt.Errorf("%d of %d keys don't match their recipients, run reencryptAll to fix them", flagged, len(inspections))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Inspect all keys")
+
+	return cmd
+}
@@ -0,0 +1,365 @@
+package cli
+
+import (
+	"denv/internal/config"
+	"denv/internal/env"
+	"denv/internal/prompt"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func printRecipients(recipients []config.Recipient, keysOnly bool) {
+	if keysOnly {
+		for _, recipient := range recipients {
+			fmt.Println(recipient.Key)
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tEMAIL\tGROUPS\tKEY\tCOMMENT")
+	for _, recipient := range recipients {
+		groups := make([]string, len(recipient.Groups))
+		for i, group := range recipient.Groups {
+			groups[i] = "@" + group
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			orDash(recipient.Name), orDash(recipient.Email), orDash(strings.Join(groups, ",")),
+			shortKey(recipient.Key), recipient.Comment)
+	}
+	w.Flush()
+}
+
+// shortKey keeps long keys such as ssh-rsa readable in tables.
+func shortKey(key string) string {
+	if len(key) <= 64 {
+		return key
+	}
+	return key[:40] + "…" + key[len(key)-16:]
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func newRecipientsCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var key string
+	var keysOnly bool
+
+	cmd := &cobra.Command{
+		Use:   "recipients [name|@group]",
+		Short: "List all recipients",
+		Long: `List the default recipients, a single recipient or the members of a group.
+With --for, list the recipients a key is encrypted to: keys matching a rule in config.yml
+are encrypted to the recipients of the first matching rule.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			userConfig := envManager.UserConfig
+			var keys []string
+			switch {
+			case cmd.Flags().Changed("for"):
+				var rule *config.RecipientRule
+				var err error
+				keys, rule, err = userConfig.RecipientsFor(key)
+				if err != nil {
+					return err
+				}
+				if rule != nil {
+					fmt.Println("# rule:", rule.Path)
+				} else {
+					fmt.Println("# default recipients")
+				}
+			case len(args) == 1:
+				var err error
+				keys, err = userConfig.ResolveRecipients(args)
+				if err != nil {
+					return err
+				}
+			default:
+				printRecipients(userConfig.Data.Recipients, keysOnly)
+				return nil
+			}
+
+			recipients := make([]config.Recipient, len(keys))
+			for i, key := range keys {
+				if recipient := userConfig.FindRecipient(key); recipient != nil {
+					recipients[i] = *recipient
+				} else {
+					recipients[i] = config.Recipient{Key: key}
+				}
+			}
+			printRecipients(recipients, keysOnly)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&key, "for", "", "Show the effective recipients of a key")
+	cmd.Flags().BoolVarP(&keysOnly, "keys", "k", false, "Only print the public keys")
+
+	return cmd
+}
+
+// parseRecipient reads an age public key or an SSH public key with an
+// optional comment.
+func parseRecipient(line string) (string, string, error) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "age1") {
+		return line, "", config.ValidateRecipientKey(line)
+	}
+	return config.ParseSSHKey(line)
+}
+
+// readRecipientsFile reads a file with one recipient per line, such as an
+// authorized_keys file or https://github.com/<user>.keys.
+func readRecipientsFile(path string) ([][2]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recipients file: %w", err)
+	}
+	var keys [][2]string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, comment, err := parseRecipient(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		keys = append(keys, [2]string{key, comment})
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no recipients found in %s", path)
+	}
+	return keys, nil
+}
+
+func newRecipientAddCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var recipient config.Recipient
+	var file string
+
+	cmd := &cobra.Command{
+		Use:   "recipientAdd <recipient> | recipientAdd -R <file>",
+		Short: "Add a recipient",
+		Long: `Add an age public key (age1...) or an SSH public key (ssh-ed25519, ssh-rsa) as recipient.
+With -R, all keys of a recipients file are added, e.g. an authorized_keys file or the keys
+of a GitHub user from https://github.com/<user>.keys.`,
+		Example: `  denv recipientAdd age1... --name alice --email alice@example.com --group backend --group ops
+  denv recipientAdd "ssh-ed25519 AAAA... bob@laptop" --name bob
+  denv recipientAdd -R carol.keys --name carol`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if (file == "") == (len(args) == 0) || len(args) > 1 {
+				return errors.New("specify a recipient or a file with -R")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var keys [][2]string
+			if file != "" {
+				var err error
+				if keys, err = readRecipientsFile(file); err != nil {
+					return err
+				}
+			} else {
+				key, comment, err := parseRecipient(args[0])
+				if err != nil {
+					return err
+				}
+				keys = append(keys, [2]string{key, comment})
+			}
+
+			for i, group := range recipient.Groups {
+				recipient.Groups[i] = strings.TrimPrefix(group, "@")
+			}
+			for i, key := range keys {
+				added := recipient
+				added.Key = key[0]
+				if added.Comment == "" {
+					added.Comment = key[1]
+				}
+				if added.Name != "" && i > 0 {
+					added.Name = fmt.Sprintf("%s-%d", added.Name, i+1)
+				}
+				if len(keys) > 1 && envManager.UserConfig.FindRecipient(added.Key) != nil {
+					fmt.Println("Skipping existing recipient", added.Key)
+					continue
+				}
+				if err := envManager.UserConfig.AddRecipient(added); err != nil {
+					return err
+				}
+				if len(keys) > 1 {
+					fmt.Println("Added recipient", describeRecipient(&added))
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "recipients-file", "R", "", "Add all recipients of a file, one per line")
+	cmd.Flags().StringVar(&recipient.Name, "name", "", "Name to refer to the recipient")
+	cmd.Flags().StringVar(&recipient.Email, "email", "", "Email of the recipient")
+	cmd.Flags().StringVar(&recipient.Comment, "comment", "", "Comment, e.g. the device of the key")
+	cmd.Flags().StringSliceVarP(&recipient.Groups, "group", "g", nil, "Groups of the recipient, can be repeated")
+
+	return cmd
+}
+
+func describeRecipient(recipient *config.Recipient) string {
+	description := recipient.Key
+	if recipient.Name != "" {
+		description = recipient.Name
+		if recipient.Email != "" {
+			description += " <" + recipient.Email + ">"
+		}
+		description += " (" + recipient.Key + ")"
+	}
+	return description
+}
+
+func printKeys(values []*env.DynamicEnvValue) {
+	for _, value := range values {
+		fmt.Println()
+		fmt.Println(value.Metadata.ID)
+		for _, name := range env.VariableNames(value) {
+			fmt.Println("  " + name)
+		}
+	}
+}
+
+func printOffboardingReport(recipient *config.Recipient, readable []*env.DynamicEnvValue, possible []*env.DynamicEnvValue, unreadable int) {
+	fmt.Println()
+	fmt.Println("Offboarding report for", describeRecipient(recipient))
+	if len(readable) == 0 && len(possible) == 0 {
+		fmt.Println("No keys were encrypted to this recipient.")
+	}
+	if len(readable) > 0 {
+		fmt.Printf("%d keys were readable, rotate the credentials in them:\n", len(readable))
+		printKeys(readable)
+	}
+	if len(possible) > 0 {
+		if len(readable) > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%d keys were possibly readable, their files don't tell which X25519 or plugin recipients they are for:\n", len(possible))
+		printKeys(possible)
+	}
+	if unreadable > 0 {
+		fmt.Printf("\nWarning: %d keys could not be decrypted with your identities and are not included.\n", unreadable)
+	}
+	fmt.Println("\nOlder versions of the files, e.g. in git history, stay readable with the removed key.")
+}
+
+// warnStillEncrypted checks the re-encrypted files for the removed key.
+func warnStillEncrypted(envManager *env.DynamicEnv, values []*env.DynamicEnvValue, key string) {
+	for _, value := range values {
+		if access, _ := envManager.RecipientAccess(value.Metadata.ID, key); access == env.AccessReadable {
+			fmt.Printf("Warning: %s is still encrypted to the key\n", value.Metadata.ID)
+		}
+	}
+}
+
+func newRecipientDelCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var yes bool
+	var noReencrypt bool
+
+	cmd := &cobra.Command{
+		Use:   "recipientDel <recipient|name>",
+		Short: "Remove a recipient and revoke its access",
+		Long: `Remove a recipient, re-encrypt the keys it could decrypt and print an offboarding report
+listing every key and variable the recipient had access to.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			recipient := envManager.UserConfig.FindRecipient(args[0])
+			if recipient == nil {
+				return fmt.Errorf("recipient not found: %s", args[0])
+			}
+			removed := *recipient
+			if err := envManager.UserConfig.Without(removed.Key).CheckRules(); err != nil {
+				return fmt.Errorf("can't remove %s, update the rules first: %w", args[0], err)
+			}
+			// Rules would still encrypt to a key they list directly
+			if paths := envManager.UserConfig.RulesReferencing(removed.Key); len(paths) > 0 {
+				return fmt.Errorf("can't remove %s, update the rules first: %s list its key", args[0], strings.Join(paths, ", "))
+			}
+
+			if !noReencrypt {
+				if err := envManager.VerifyIdentities(); err != nil {
+					return err
+				}
+			}
+
+			files, err := envManager.ListEnvFiles("")
+			if err != nil {
+				return fmt.Errorf("failed to list keys: %w", err)
+			}
+			stored := 0
+			for _, file := range files {
+				if !strings.HasSuffix(file, envManager.Config.EnvSuffix) {
+					continue
+				}
+				data, err := envManager.Filehandler.ReadFile(filepath.Join(envManager.Config.DataDir, file))
+				if err != nil || !env.IsPassphraseProtected(data) {
+					stored++
+				}
+			}
+			items := envManager.ListItems("")
+
+			var all, readable, possible []*env.DynamicEnvValue
+			for _, value := range items {
+				all = append(all, value)
+				access, err := envManager.RecipientAccess(value.Metadata.ID, removed.Key)
+				if err != nil {
+					return err
+				}
+				switch access {
+				case env.AccessReadable:
+					readable = append(readable, value)
+				case env.AccessPossible:
+					possible = append(possible, value)
+				}
+			}
+			for _, values := range [][]*env.DynamicEnvValue{readable, possible} {
+				sort.Slice(values, func(i, j int) bool {
+					return values[i].Metadata.ID < values[j].Metadata.ID
+				})
+			}
+
+			if _, err := envManager.UserConfig.RemoveRecipient(removed.Key); err != nil {
+				return err
+			}
+			fmt.Println("Removed recipient", describeRecipient(&removed))
+
+			// Stanzas can't rule out every recipient, so all keys are re-encrypted
+			var reencryptErr error
+			switch {
+			case len(readable) == 0 && len(possible) == 0:
+			case noReencrypt:
+				fmt.Println("Keys were not re-encrypted, run reencryptAll to revoke access.")
+			case yes || prompt.Confirm(fmt.Sprintf("Re-encrypt all %d keys to revoke access?", len(items))):
+				if reencryptErr = envManager.Reencrypt(all); reencryptErr == nil {
+					fmt.Printf("Re-encrypted %d keys.\n", len(items))
+					warnStillEncrypted(envManager, all, removed.Key)
+				}
+			default:
+				fmt.Println("Keys were not re-encrypted, run reencryptAll to revoke access.")
+			}
+
+			printOffboardingReport(&removed, readable, possible, stored-len(items))
+			return reencryptErr
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Re-encrypt the keys without asking")
+	cmd.Flags().BoolVar(&noReencrypt, "no-reencrypt", false, "Only remove the recipient from the configuration")
+
+	return cmd
+}
@@ -0,0 +1,260 @@
+package cli
+
+import (
+	"denv/internal/env"
+	"denv/internal/redact"
+	"denv/internal/runner"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type runOptions struct {
+	envKeys     []string
+	export      bool
+	clean       bool
+	keep        []string
+	redact      bool
+	watch       bool
+	watchSignal string
+	watchGrace  time.Duration
+}
+
+func newRunCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var options runOptions
+
+	cmd := &cobra.Command{
+		Use:   "run [flags] [--] <command> [args...]",
+		Short: "Run command with environment variables",
+		Long: `Run a command with environment variables loaded from the specified keys.
+You can also export the environment variables to stdout using the --export flag.
+
+The exit code of the command is passed through and signals are forwarded to it.`,
+		Args:          cobra.ArbitraryArgs, // Accepts any arguments after the command
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			osEnvKeys := strings.Split(os.Getenv("DENV_KEYS"), ",")
+			for _, key := range osEnvKeys {
+				key = strings.TrimSpace(key)
+				if key != "" {
+					options.envKeys = append(options.envKeys, key)
+				}
+			}
+
+			if options.export {
+				envVars := envManager.GetEnvs(envManager.ResolveKeys(options.envKeys))
+				for key, value := range envVars {
+					fmt.Printf("%s=%s\n", key, value)
+				}
+				if dir := envManager.FileDir(); dir != "" {
+					envManager.KeepFiles()
+					fmt.Fprintf(os.Stderr, "Secret files are kept in %s, remove them when done\n", dir)
+				}
+				return nil
+			}
+
+			if len(args) == 0 {
+				return errors.New("no command provided to run")
+			}
+
+			if options.watch {
+				return runWatch(envManager, &options, args)
+			}
+
+			parsed, environ := resolveRunEnv(envManager, &options, nil)
+			// Identities are not needed while the command runs
+			envManager.CleanupIdentities()
+
+			// Nothing to clean up, hand the process over to the command
+			if envManager.FileDir() == "" && !options.redact {
+				return runner.Exec(args, environ)
+			}
+
+			defer envManager.CleanupFiles()
+			cmdExec, flush := newRunCmd(args, environ, parsed, &options)
+			defer flush()
+			return runner.Run(cmdExec)
+		},
+	}
+
+	// Flags after the command name belong to the command
+	cmd.Flags().SetInterspersed(false)
+
+	cmd.Flags().StringArrayVarP(&options.envKeys, "env", "e", []string{}, "Keys to load environment variables")
+	cmd.Flags().BoolVar(&options.export, "export", false, "Print environment variables to stdout")
+	cmd.Flags().BoolVar(&options.clean, "clean", false, "Start from an empty environment instead of inheriting the current one")
+	cmd.Flags().StringSliceVar(&options.keep, "keep", []string{}, "Variables to inherit even with --clean, e.g. PATH,HOME")
+	cmd.Flags().BoolVar(&options.redact, "redact", false, "Replace secret values in the output of the command")
+	cmd.Flags().BoolVar(&options.watch, "watch", false, "Restart the command when its keys change")
+	cmd.Flags().StringVar(&options.watchSignal, "watch-signal", "TERM", "Signal to stop the command before restarting")
+	cmd.Flags().DurationVar(&options.watchGrace, "watch-grace", 10*time.Second, "Time to wait for the command to stop before killing it")
+
+	return cmd
+}
+
+func resolveRunEnv(envManager *env.DynamicEnv, options *runOptions, overrides map[string]string) (*env.DynamicEnvParsed, []string) {
+	parsed := envManager.ParseEnvs(envManager.ResolveKeys(options.envKeys))
+	for key, value := range overrides {
+		parsed.Env[key] = value
+	}
+	environOptions := envManager.EnvironmentOptions()
+	environOptions.Clean = environOptions.Clean || options.clean
+	environOptions.Keep = append(environOptions.Keep, options.keep...)
+	return parsed, env.BuildEnviron(os.Environ(), parsed.Env, environOptions)
+}
+
+func newRunCmd(args []string, environ []string, parsed *env.DynamicEnvParsed, options *runOptions) (*exec.Cmd, func()) {
+	return newRunCmdWithOutput(args, environ, parsed, options, os.Stdout, os.Stderr)
+}
+
+func newRunCmdWithOutput(args []string, environ []string, parsed *env.DynamicEnvParsed, options *runOptions, stdout io.Writer, stderr io.Writer) (*exec.Cmd, func()) {
+	cmdExec := runner.Command(args, environ)
+	cmdExec.Stdout = stdout
+	cmdExec.Stderr = stderr
+	if !options.redact {
+		return cmdExec, func() {}
+	}
+	secrets := parsed.SecretEnvs()
+	redactedStdout := redact.New(stdout, secrets)
+	redactedStderr := redact.New(stderr, secrets)
+	cmdExec.Stdout = redactedStdout
+	cmdExec.Stderr = redactedStderr
+	return cmdExec, func() {
+		redactedStdout.Flush()
+		redactedStderr.Flush()
+	}
+}
+
+func watchedFiles(envManager *env.DynamicEnv, parsed *env.DynamicEnvParsed) []string {
+	files := []string{filepath.Join(envManager.Filehandler.RootDir, envManager.Config.IndexFile)}
+	for _, source := range parsed.Sources {
+		files = append(files, filepath.Join(envManager.Filehandler.RootDir, source))
+	}
+	if envManager.Project.Path != "" {
+		files = append(files, envManager.Project.Path)
+	}
+	return files
+}
+
+func fileStamps(files []string) map[string]string {
+	stamps := make(map[string]string)
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			stamps[file] = fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return stamps
+}
+
+func stampsChanged(files []string, stamps map[string]string) bool {
+	current := fileStamps(files)
+	if len(current) != len(stamps) {
+		return true
+	}
+	for file, stamp := range current {
+		if stamps[file] != stamp {
+			return true
+		}
+	}
+	return false
+}
+
+func changedVariables(before, after map[string]string) []string {
+	var changed []string
+	for key, value := range after {
+		if old, ok := before[key]; !ok || old != value {
+			changed = append(changed, key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func runWatch(envManager *env.DynamicEnv, options *runOptions, args []string) error {
+	stopSignal, err := runner.ParseSignal(options.watchSignal)
+	if err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	runner.NotifySignals(signals)
+	defer signal.Stop(signals)
+	defer envManager.CleanupFiles()
+	defer envManager.CleanupIdentities()
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	parsed, environ := resolveRunEnv(envManager, options, nil)
+	// Identities are written again from memory when the keys are reloaded
+	envManager.CleanupIdentities()
+	for {
+		files := watchedFiles(envManager, parsed)
+		stamps := fileStamps(files)
+
+		cmdExec, flush := newRunCmd(args, environ, parsed, options)
+		process, err := runner.Start(cmdExec)
+		if err != nil {
+			return err
+		}
+		exited := process.Done()
+
+	wait:
+		for {
+			select {
+			case sig := <-signals:
+				if runner.IsTermination(sig) {
+					err := process.Stop(sig, options.watchGrace)
+					flush()
+					return err
+				}
+				process.Signal(sig)
+			case <-exited:
+				flush()
+				code := 0
+				var exitErr *runner.ExitError
+				if errors.As(process.Err(), &exitErr) {
+					code = exitErr.Code
+				}
+				fmt.Fprintf(os.Stderr, "denv: command exited with code %d, waiting for changes\n", code)
+				exited = nil
+			case <-ticker.C:
+				if stampsChanged(files, stamps) {
+					break wait
+				}
+			}
+		}
+
+		process.Stop(stopSignal, options.watchGrace)
+		flush()
+		envManager.CleanupFiles()
+		if err := envManager.Reload(); err != nil {
+			fmt.Fprintf(os.Stderr, "denv: failed to reload: %v\n", err)
+		}
+
+		before := parsed.Env
+		parsed, environ = resolveRunEnv(envManager, options, nil)
+		envManager.CleanupIdentities()
+		changed := changedVariables(before, parsed.Env)
+		if len(changed) == 0 {
+			fmt.Fprintln(os.Stderr, "denv: restarting, no variables changed")
+		} else {
+			fmt.Fprintf(os.Stderr, "denv: restarting, changed variables: %s\n", strings.Join(changed, ", "))
+		}
+	}
+}
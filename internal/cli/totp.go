@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"denv/internal/env"
+	"denv/internal/totp"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// findTOTPSeed returns the only variable of a key that holds an otpauth URI
+// or whose name mentions TOTP.
+func findTOTPSeed(parsed *env.DynamicEnvValue) (string, error) {
+	var candidates []string
+	for _, section := range []string{"local", "env"} {
+		values, ok := parsed.Data[section].(map[string]any)
+		if !ok {
+			continue
+		}
+		for name, value := range values {
+			text, _ := value.(string)
+			if strings.HasPrefix(text, "otpauth://totp/") || strings.Contains(strings.ToUpper(name), "TOTP") {
+				candidates = append(candidates, name)
+			}
+		}
+	}
+	sort.Strings(candidates)
+	switch len(candidates) {
+	case 0:
+		return "", errors.New("no TOTP seed found, specify the variable")
+	case 1:
+		return candidates[0], nil
+	}
+	return "", fmt.Errorf("several TOTP seeds found, specify one of: %s", strings.Join(candidates, ", "))
+}
+
+func newTOTPCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var digits int
+	var period int
+	var algorithm string
+	var timestamp int64
+
+	cmd := &cobra.Command{
+		Use:   "totp <key> [VAR]",
+		Short: "Print the current TOTP code of a stored seed",
+		Long: `Print the current TOTP code (RFC 6238) of a seed stored in a variable of a key.
+The seed is either base32 encoded or an otpauth:// URI, whose parameters are used unless overridden.
+Without a variable, the only variable holding an otpauth URI or named like *TOTP* is used.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			parsed, err := envManager.GetEnv(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to retrieve key: %w", err)
+			}
+
+			name := ""
+			if len(args) == 2 {
+				name = args[1]
+			} else if name, err = findTOTPSeed(parsed); err != nil {
+				return err
+			}
+
+			seed, ok, err := parsed.GetVariable("local", name)
+			if err == nil && !ok {
+				seed, ok, err = parsed.GetVariable("env", name)
+			}
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("variable not found: %s", name)
+			}
+
+			config, err := totp.Parse(seed)
+			if err != nil {
+				return fmt.Errorf("invalid TOTP seed in %s: %w", name, err)
+			}
+			if cmd.Flags().Changed("digits") {
+				config.Digits = digits
+			}
+			if cmd.Flags().Changed("period") {
+				config.Period = period
+			}
+			if cmd.Flags().Changed("algorithm") {
+				config.Algorithm = algorithm
+			}
+
+			now := time.Now()
+			if cmd.Flags().Changed("time") {
+				now = time.Unix(timestamp, 0)
+			}
+			code, err := config.Code(now)
+			if err != nil {
+				return err
+			}
+			fmt.Println(code)
+			if !cmd.Flags().Changed("time") {
+				fmt.Fprintf(os.Stderr, "valid for %s\n", config.Remaining(now))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&digits, "digits", 6, "Number of digits of the code")
+	cmd.Flags().IntVar(&period, "period", 30, "Seconds a code is valid")
+	cmd.Flags().StringVar(&algorithm, "algorithm", "SHA1", "Hash algorithm: SHA1, SHA256 or SHA512")
+	cmd.Flags().Int64Var(&timestamp, "time", 0, "Compute the code for a Unix timestamp instead of now")
+
+	return cmd
+}
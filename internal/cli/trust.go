@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"denv/internal/env"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func newTrustCommand(envManager *env.DynamicEnv) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trust",
+		Short: "Trust the keys and processes of the project manifest",
+		Long: `Add the project manifest found from the current directory to the trusted manifests
+in config.yml. Its keys and processes are only used when it is trusted, and it has to be
+trusted again after it changes.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			project := envManager.Project
+			if project.Path == "" {
+				return errors.New("no project manifest found")
+			}
+			if len(project.Data.Keys) > 0 {
+				fmt.Println("Keys:", strings.Join(project.Data.Keys, ", "))
+			}
+			for _, process := range project.Data.Processes {
+				fmt.Printf("Process %s: %s\n", process.Name, process.Command)
+				if len(process.Keys) > 0 {
+					fmt.Println("  keys:", strings.Join(process.Keys, ", "))
+				}
+			}
+			if err := envManager.UserConfig.TrustProject(project); err != nil {
+				return fmt.Errorf("failed to save config: %w", err)
+			}
+			fmt.Println("Trusted", project.Path)
+			return nil
+		},
+	}
+
+	return cmd
+}
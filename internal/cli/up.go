@@ -0,0 +1,245 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"denv/internal/config"
+	"denv/internal/env"
+	"denv/internal/runner"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+	}
+	return len(data), nil
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.w.Write(p.prefix)
+	p.w.Write(line)
+}
+
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.writeLine(append(p.buf, '\n'))
+		p.buf = nil
+	}
+}
+
+func parseProcfile(data string) ([]config.ProcessConfig, error) {
+	var processes []config.ProcessConfig
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid Procfile line: %s", line)
+		}
+		processes = append(processes, config.ProcessConfig{
+			Name:    strings.TrimSpace(parts[0]),
+			Command: strings.TrimSpace(parts[1]),
+		})
+	}
+	return processes, scanner.Err()
+}
+
+func loadProcesses(envManager *env.DynamicEnv, file string) ([]config.ProcessConfig, error) {
+	if file == "" {
+		if len(envManager.Project.Data.Processes) > 0 {
+			if !envManager.Project.IsTrusted(envManager.UserConfig) {
+				return nil, fmt.Errorf("%s is not trusted, run denv trust to use its processes", envManager.Project.Path)
+			}
+			fmt.Fprintf(os.Stderr, "denv: using processes from %s\n", envManager.Project.Path)
+			return envManager.Project.Data.Processes, nil
+		}
+		file = "Procfile"
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := filepath.Ext(file)
+	if ext != ".yml" && ext != ".yaml" {
+		return parseProcfile(string(data))
+	}
+
+	var project config.ProjectConfigData
+	if err := yaml.Unmarshal(data, &project); err != nil {
+		return nil, err
+	}
+	return project.Processes, nil
+}
+
+func newUpCommand(envManager *env.DynamicEnv) *cobra.Command {
+	var options runOptions
+	var file string
+	var grace time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "up",
+		Short: "Run multiple processes with environment variables",
+		Long: `Run multiple processes, each with its own keys and variables.
+Processes are read from the project manifest, a YAML file with a "processes" list, or a Procfile.
+When one of them exits, all the others are stopped.`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			processes, err := loadProcesses(envManager, file)
+			if err != nil {
+				return fmt.Errorf("failed to load processes: %w", err)
+			}
+			if len(processes) == 0 {
+				return errors.New("no processes to run")
+			}
+			for _, process := range processes {
+				if process.Name == "" || process.Command == "" {
+					return errors.New("each process needs a name and a command")
+				}
+			}
+			return runProcesses(envManager, &options, processes, grace)
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "Procfile or YAML file with processes, defaults to the project manifest or ./Procfile")
+	cmd.Flags().StringArrayVarP(&options.envKeys, "env", "e", []string{}, "Keys to load for all processes")
+	cmd.Flags().BoolVar(&options.clean, "clean", false, "Start from an empty environment instead of inheriting the current one")
+	cmd.Flags().StringSliceVar(&options.keep, "keep", []string{}, "Variables to inherit even with --clean, e.g. PATH,HOME")
+	cmd.Flags().BoolVar(&options.redact, "redact", false, "Replace secret values in the output of the processes")
+	cmd.Flags().DurationVar(&grace, "grace", 10*time.Second, "Time to wait for processes to stop before killing them")
+
+	return cmd
+}
+
+func runProcesses(envManager *env.DynamicEnv, options *runOptions, processes []config.ProcessConfig, grace time.Duration) error {
+	defer envManager.CleanupFiles()
+
+	width := 0
+	for _, process := range processes {
+		if len(process.Name) > width {
+			width = len(process.Name)
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	runner.NotifySignals(signals)
+	defer signal.Stop(signals)
+
+	var outputLock sync.Mutex
+	var started []*runner.Process
+	var flushes []func()
+	exited := make(chan *runner.Process, len(processes))
+
+	stopAll := func(sig os.Signal) {
+		var wg sync.WaitGroup
+		for _, p := range started {
+			wg.Add(1)
+			go func(p *runner.Process) {
+				defer wg.Done()
+				p.Stop(sig, grace)
+			}(p)
+		}
+		wg.Wait()
+		for _, flush := range flushes {
+			flush()
+		}
+	}
+
+	for i, process := range processes {
+		processOptions := *options
+		processOptions.envKeys = append(append([]string{}, options.envKeys...), process.Keys...)
+		envManager.SetFileScope(fmt.Sprintf("%d-%s", i, filepath.Base(process.Name)))
+		parsed, environ := resolveRunEnv(envManager, &processOptions, process.Env)
+
+		prefix := []byte(fmt.Sprintf("%-*s | ", width, process.Name))
+		stdout := &prefixWriter{mu: &outputLock, w: os.Stdout, prefix: prefix}
+		stderr := &prefixWriter{mu: &outputLock, w: os.Stderr, prefix: prefix}
+		cmdExec, flush := newRunCmdWithOutput(runner.ShellArgs(process.Command), environ, parsed, &processOptions, stdout, stderr)
+		// Processes share the terminal, none of them reads from it
+		cmdExec.Stdin = nil
+		flushes = append(flushes, func() {
+			flush()
+			stdout.Flush()
+			stderr.Flush()
+		})
+
+		p, err := runner.Start(cmdExec)
+		if err != nil {
+			stopAll(defaultStopSignal())
+			return fmt.Errorf("failed to start %s: %w", process.Name, err)
+		}
+		started = append(started, p)
+		go func(p *runner.Process) {
+			<-p.Done()
+			exited <- p
+		}(p)
+	}
+	envManager.SetFileScope("")
+	// Identities are not needed while the processes run
+	envManager.CleanupIdentities()
+
+	for {
+		select {
+		case sig := <-signals:
+			if runner.IsTermination(sig) {
+				stopAll(sig)
+				return runner.SignalError(sig)
+			}
+			for _, p := range started {
+				p.Signal(sig)
+			}
+		case p := <-exited:
+			name := ""
+			for i, s := range started {
+				if s == p {
+					name = processes[i].Name
+				}
+			}
+			fmt.Fprintf(os.Stderr, "denv: %s exited, stopping all processes\n", name)
+			stopAll(defaultStopSignal())
+			if err := p.Err(); err != nil {
+				return err
+			}
+			// Processes are expected to keep running
+			return &runner.ExitError{Code: 1}
+		}
+	}
+}
+
+func defaultStopSignal() os.Signal {
+	sig, _ := runner.ParseSignal("TERM")
+	return sig
+}
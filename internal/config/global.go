@@ -4,16 +4,60 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type ConfigType struct {
-	RootDir    string
+	RootDir string
+	// Identity file written by init, the first file in DENV_IDENTITIES
 	Identities string
-	DataDir    string
-	EnvSuffix  string
-	IndexFile  string
-	ConfigFile string
-	Debug      bool
+	// Identity files tried in order, "-" for stdin and "fd:N" for a file descriptor
+	IdentitySources []string
+	// Identity content from DENV_IDENTITY, tried first
+	IdentityData string
+	DataDir      string
+	EnvSuffix    string
+	IndexFile    string
+	ConfigFile   string
+	Debug        bool
+}
+
+// defaultIdentityFiles returns the default identities file and the SSH keys
+// in ~/.ssh that exist.
+func defaultIdentityFiles(identities string) []string {
+	var files []string
+	candidates := []string{
+		identities,
+		filepath.Join(os.Getenv("HOME"), ".ssh", "id_ed25519"),
+		filepath.Join(os.Getenv("HOME"), ".ssh", "id_rsa"),
+	}
+	for _, file := range candidates {
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return []string{identities}
+	}
+	return files
+}
+
+// splitIdentitySources splits a list separated like PATH, keeping "fd:N"
+// sources together on systems where ":" separates the list.
+func splitIdentitySources(list string) []string {
+	var sources []string
+	parts := filepath.SplitList(list)
+	for i := 0; i < len(parts); i++ {
+		source := parts[i]
+		if source == "fd" && i+1 < len(parts) {
+			source = "fd:" + parts[i+1]
+			i++
+		}
+		if source != "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources
 }
 
 func NewConfig() *ConfigType {
@@ -21,22 +65,38 @@ func NewConfig() *ConfigType {
 	if rootDir == "" {
 		rootDir = filepath.Join(os.Getenv("HOME"), ".config", "denv")
 	}
+	identityData := os.Getenv("DENV_IDENTITY")
 	identities := os.Getenv("DENV_IDENTITIES")
-	if identities == "" {
+	var identitySources []string
+	if identities != "" {
+		identitySources = splitIdentitySources(identities)
+		identities = ""
+		for _, source := range identitySources {
+			if source != "-" && !strings.HasPrefix(source, "fd:") {
+				identities = source
+				break
+			}
+		}
+	} else {
 		identities = filepath.Join(os.Getenv("HOME"), ".keys", "identities")
+		if identityData == "" {
+			identitySources = defaultIdentityFiles(identities)
+		}
 	}
 	debug := os.Getenv("DENV_DEBUG") == "true"
 	if debug {
 		log.Printf("rootDir: %s", rootDir)
-		log.Printf("identities: %s", identities)
+		log.Printf("identities: %v, inline: %t", identitySources, identityData != "")
 	}
 	return &ConfigType{
-		RootDir:    rootDir,
-		Identities: identities,
-		DataDir:    "env",
-		EnvSuffix:  ".age",
-		IndexFile:  "temp/index.yml",
-		ConfigFile: "config.yml",
-		Debug:      debug,
+		RootDir:         rootDir,
+		Identities:      identities,
+		IdentitySources: identitySources,
+		IdentityData:    identityData,
+		DataDir:         "env",
+		EnvSuffix:       ".age",
+		IndexFile:       "temp/index.yml",
+		ConfigFile:      "config.yml",
+		Debug:           debug,
 	}
 }
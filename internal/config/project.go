@@ -0,0 +1,128 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const ProjectFile = ".denv.yml"
+
+type EnvironmentConfig struct {
+	Clean bool     `yaml:"clean,omitempty"`
+	Keep  []string `yaml:"keep,omitempty"`
+	Allow []string `yaml:"allow,omitempty"`
+	Deny  []string `yaml:"deny,omitempty"`
+	// Project is the policy of the project manifest, it can only exclude
+	// more variables
+	Project *EnvironmentConfig `yaml:"-"`
+}
+
+type ProcessConfig struct {
+	Name    string            `yaml:"name"`
+	Command string            `yaml:"command"`
+	Keys    []string          `yaml:"keys"`
+	Env     map[string]string `yaml:"env"`
+}
+
+type ProjectConfigData struct {
+	Keys        []string          `yaml:"keys"`
+	Environment EnvironmentConfig `yaml:"environment"`
+	Processes   []ProcessConfig   `yaml:"processes"`
+}
+
+type ProjectConfigType struct {
+	Path string
+	// Hash is the SHA-256 of the manifest, to trust it as it was reviewed
+	Hash string
+	Data ProjectConfigData
+}
+
+// TrustedProject is a manifest whose keys and processes may be used.
+type TrustedProject struct {
+	Path   string `yaml:"path"`
+	SHA256 string `yaml:"sha256"`
+}
+
+func findProjectFile() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, ProjectFile)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func NewProjectConfig(config *ConfigType) *ProjectConfigType {
+	projectConfig := &ProjectConfigType{Path: findProjectFile()}
+	if projectConfig.Path == "" {
+		return projectConfig
+	}
+	err := projectConfig.LoadProjectConfig()
+	if config.Debug {
+		if err != nil {
+			log.Printf("Error loading project config: %v\n", err)
+		} else {
+			log.Printf("Project config %s: %+v\n", projectConfig.Path, projectConfig.Data)
+		}
+	}
+	return projectConfig
+}
+
+func (c *ProjectConfigType) LoadProjectConfig() error {
+	data, err := os.ReadFile(c.Path)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	c.Hash = hex.EncodeToString(sum[:])
+	c.Data = ProjectConfigData{}
+	return yaml.Unmarshal(data, &c.Data)
+}
+
+// IsTrusted reports whether the manifest is in the trusted list of config.yml
+// with its current content.
+func (c *ProjectConfigType) IsTrusted(userConfig *UserConfigType) bool {
+	for _, trusted := range userConfig.Data.TrustedProjects {
+		if trusted.Path == c.Path && trusted.SHA256 == c.Hash {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustProject adds a manifest to the trusted list, replacing an older
+// version of it.
+func (c *UserConfigType) TrustProject(project *ProjectConfigType) error {
+	trusted := []TrustedProject{}
+	for _, existing := range c.Data.TrustedProjects {
+		if existing.Path != project.Path {
+			trusted = append(trusted, existing)
+		}
+	}
+	c.Data.TrustedProjects = append(trusted, TrustedProject{Path: project.Path, SHA256: project.Hash})
+	return c.SaveUserConfig()
+}
+
+// Merge adds the policy of a project manifest. A manifest is found in any
+// parent directory, so it is applied on top and can't inherit variables
+// that this policy excludes.
+func (e EnvironmentConfig) Merge(project EnvironmentConfig) EnvironmentConfig {
+	result := e
+	result.Keep = append([]string{}, e.Keep...)
+	result.Project = &project
+	return result
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * Recipients are age or SSH public keys, either bare or in entries with
+ * details. Groups collect recipients under a name that rules and commands
+ * refer to as `@name`:
+ *
+ * ```
+ * recipients:
+ *   - age1...
+ *   - key: age1...
+ *     name: alice
+ *     email: alice@example.com
+ *     comment: laptop
+ *     groups: [backend, ops]
+ * ```
+ */
+
+type Recipient struct {
+	Key     string   `yaml:"key"`
+	Name    string   `yaml:"name,omitempty"`
+	Email   string   `yaml:"email,omitempty"`
+	Comment string   `yaml:"comment,omitempty"`
+	Groups  []string `yaml:"groups,omitempty"`
+}
+
+type recipientFields Recipient
+
+func (r *Recipient) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*r = Recipient{Key: node.Value}
+		return nil
+	}
+	var fields recipientFields
+	if err := node.Decode(&fields); err != nil {
+		return err
+	}
+	if fields.Key == "" {
+		return fmt.Errorf("line %d: recipient without key", node.Line)
+	}
+	*r = Recipient(fields)
+	return nil
+}
+
+func (r Recipient) MarshalYAML() (any, error) {
+	if r.Name == "" && r.Email == "" && r.Comment == "" && len(r.Groups) == 0 {
+		return r.Key, nil
+	}
+	return recipientFields(r), nil
+}
+
+func (r Recipient) InGroup(group string) bool {
+	for _, g := range r.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func bech32Polymod(values []byte) uint32 {
+	generator := []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+// validBech32 checks the checksum of a lowercase bech32 string.
+func validBech32(s string) bool {
+	separator := strings.LastIndex(s, "1")
+	if separator < 1 || separator+7 > len(s) {
+		return false
+	}
+	hrp, data := s[:separator], s[separator+1:]
+	values := make([]byte, 0, len(hrp)*2+1+len(data))
+	for _, c := range hrp {
+		values = append(values, byte(c>>5))
+	}
+	values = append(values, 0)
+	for _, c := range hrp {
+		values = append(values, byte(c&31))
+	}
+	for _, c := range data {
+		i := strings.IndexRune(bech32Charset, c)
+		if i < 0 {
+			return false
+		}
+		values = append(values, byte(i))
+	}
+	return bech32Polymod(values) == 1
+}
+
+var sshKeyTypes = []string{"ssh-ed25519", "ssh-rsa"}
+
+func isSSHKeyType(keyType string) bool {
+	for _, t := range sshKeyTypes {
+		if t == keyType {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSSHKey reads a public key in the authorized_keys format, including
+// lines with options, and returns it without comment.
+func ParseSSHKey(line string) (string, string, error) {
+	fields := strings.Fields(line)
+	for i := 0; i+1 < len(fields); i++ {
+		if !isSSHKeyType(fields[i]) {
+			continue
+		}
+		wire, err := base64.StdEncoding.DecodeString(fields[i+1])
+		if err != nil || len(wire) < 4 {
+			return "", "", errors.New("invalid SSH public key encoding")
+		}
+		n := binary.BigEndian.Uint32(wire)
+		if uint32(len(wire)-4) < n || string(wire[4:4+n]) != fields[i] {
+			return "", "", errors.New("SSH public key does not match its type")
+		}
+		return fields[i] + " " + fields[i+1], strings.Join(fields[i+2:], " "), nil
+	}
+	for _, field := range fields {
+		if strings.HasPrefix(field, "ssh-") || strings.HasPrefix(field, "ecdsa-") || strings.HasPrefix(field, "sk-") {
+			return "", "", fmt.Errorf("unsupported SSH key type %s, use one of: %s", field, strings.Join(sshKeyTypes, ", "))
+		}
+	}
+	return "", "", errors.New("not an SSH public key")
+}
+
+// NormalizeRecipientKey strips the comment of SSH public keys.
+func NormalizeRecipientKey(key string) string {
+	if strings.HasPrefix(key, "ssh-") {
+		if normalized, _, err := ParseSSHKey(key); err == nil {
+			return normalized
+		}
+	}
+	return strings.TrimSpace(key)
+}
+
+func ValidateRecipientKey(key string) error {
+	if strings.HasPrefix(key, "ssh-") {
+		_, _, err := ParseSSHKey(key)
+		return err
+	}
+	if !strings.HasPrefix(key, "age1") {
+		return errors.New("recipient must be an age public key (age1...) or an SSH public key (ssh-ed25519, ssh-rsa)")
+	}
+	if key != strings.ToLower(key) || !validBech32(key) {
+		return errors.New("recipient is not a valid age public key, check for typos")
+	}
+	return nil
+}
+
+// ResolveRecipients expands recipient keys, names of recipients and
+// `@group` references into keys.
+func (c *UserConfigType) ResolveRecipients(references []string) ([]string, error) {
+	var keys []string
+	seen := make(map[string]bool)
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	for _, reference := range references {
+		if strings.HasPrefix(reference, "@") {
+			group := strings.TrimPrefix(reference, "@")
+			found := false
+			for _, recipient := range c.Data.Recipients {
+				if recipient.InGroup(group) {
+					add(recipient.Key)
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unknown group: %s", reference)
+			}
+			continue
+		}
+		if recipient := c.FindRecipient(reference); recipient != nil {
+			add(recipient.Key)
+			continue
+		}
+		if !strings.HasPrefix(reference, "age1") && !strings.HasPrefix(reference, "ssh-") {
+			return nil, fmt.Errorf("unknown recipient: %s", reference)
+		}
+		add(NormalizeRecipientKey(reference))
+	}
+	return keys, nil
+}
+
+// FindRecipient looks a recipient up by key or name.
+func (c *UserConfigType) FindRecipient(reference string) *Recipient {
+	for i, recipient := range c.Data.Recipients {
+		if recipient.Key == NormalizeRecipientKey(reference) || (recipient.Name != "" && recipient.Name == reference) {
+			return &c.Data.Recipients[i]
+		}
+	}
+	return nil
+}
+
+func (c *UserConfigType) RecipientKeys() []string {
+	keys := make([]string, len(c.Data.Recipients))
+	for i, recipient := range c.Data.Recipients {
+		keys[i] = recipient.Key
+	}
+	return keys
+}
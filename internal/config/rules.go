@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+ * Recipient rules map keys to the recipients they are encrypted to. The first
+ * rule whose path matches the key is used, keys without a matching rule are
+ * encrypted to the default recipients:
+ *
+ * ```
+ * recipients:
+ *   - age1...
+ * rules:
+ *   - path: prod/**
+ *     recipients:
+ *       - age1...
+ *   - path: team-a/*
+ *     recipients:
+ *       - age1...
+ * ```
+ *
+ * Rules refer to recipients by key, by name or to groups as `@name`.
+ * In paths, `*` matches within a segment, `**` matches any number of segments
+ * and a trailing `/` matches everything below the prefix.
+ */
+
+type RecipientRule struct {
+	Path       string   `yaml:"path"`
+	Recipients []string `yaml:"recipients"`
+}
+
+func pathPattern(path string) *regexp.Regexp {
+	if strings.HasSuffix(path, "/") {
+		path += "**"
+	}
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for i := 0; i < len(path); i++ {
+		switch {
+		case strings.HasPrefix(path[i:], "**/"):
+			pattern.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(path[i:], "**"):
+			pattern.WriteString(".*")
+			i++
+		case path[i] == '*':
+			pattern.WriteString("[^/]*")
+		case path[i] == '?':
+			pattern.WriteString("[^/]")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(path[i : i+1]))
+		}
+	}
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String())
+}
+
+func (r RecipientRule) Matches(key string) bool {
+	return pathPattern(r.Path).MatchString(key)
+}
+
+// RecipientsFor returns the recipient keys of a key and the rule that
+// selected them, nil for the default recipients.
+func (c *UserConfigType) RecipientsFor(key string) ([]string, *RecipientRule, error) {
+	for i, rule := range c.Data.Rules {
+		if rule.Matches(key) {
+			recipients, err := c.ResolveRecipients(rule.Recipients)
+			if err != nil {
+				return nil, nil, fmt.Errorf("rule %s: %w", rule.Path, err)
+			}
+			return recipients, &c.Data.Rules[i], nil
+		}
+	}
+	return c.RecipientKeys(), nil, nil
+}
+
+// CheckRules resolves the recipients of every rule.
+func (c *UserConfigType) CheckRules() error {
+	for _, rule := range c.Data.Rules {
+		recipients, err := c.ResolveRecipients(rule.Recipients)
+		if err != nil {
+			return fmt.Errorf("rule %s: %w", rule.Path, err)
+		}
+		if len(recipients) == 0 {
+			return fmt.Errorf("rule %s has no recipients", rule.Path)
+		}
+	}
+	return nil
+}
+
+// RulesReferencing returns the paths of the rules that list a recipient key
+// directly instead of by name or group.
+func (c *UserConfigType) RulesReferencing(key string) []string {
+	var paths []string
+	for _, rule := range c.Data.Rules {
+		for _, reference := range rule.Recipients {
+			if !strings.HasPrefix(reference, "@") && NormalizeRecipientKey(reference) == key {
+				paths = append(paths, rule.Path)
+				break
+			}
+		}
+	}
+	return paths
+}
@@ -3,13 +3,23 @@ package config
 import (
 	"denv/internal/filehandler"
 	"errors"
+	"fmt"
 	"log"
 
 	"gopkg.in/yaml.v3"
 )
 
+type ProvidersConfig struct {
+	Allow   []string `yaml:"allow,omitempty"`
+	Timeout int      `yaml:"timeout,omitempty"`
+}
+
 type UserConfigData struct {
-	Recipients []string `yaml:"recipients"`
+	Recipients      []Recipient       `yaml:"recipients"`
+	Rules           []RecipientRule   `yaml:"rules,omitempty"`
+	Providers       ProvidersConfig   `yaml:"providers,omitempty"`
+	Environment     EnvironmentConfig `yaml:"environment,omitempty"`
+	TrustedProjects []TrustedProject  `yaml:"trusted_projects,omitempty"`
 }
 
 type UserConfigType struct {
@@ -50,24 +60,55 @@ func (c *UserConfigType) SaveUserConfig() error {
 	return c.filehandler.WriteFile(c.config.ConfigFile, string(data))
 }
 
-func (c *UserConfigType) AddRecipient(publicKey string) error {
-	for _, recipient := range c.Data.Recipients {
-		if recipient == publicKey {
+func (c *UserConfigType) AddRecipient(recipient Recipient) error {
+	for _, existing := range c.Data.Recipients {
+		if existing.Key == recipient.Key {
 			return errors.New("recipient already exists")
 		}
+		if recipient.Name != "" && existing.Name == recipient.Name {
+			return fmt.Errorf("a recipient named %s already exists", recipient.Name)
+		}
 	}
 
-	c.Data.Recipients = append(c.Data.Recipients, publicKey)
+	c.Data.Recipients = append(c.Data.Recipients, recipient)
 	return c.SaveUserConfig()
 }
 
-func (c *UserConfigType) RemoveRecipient(publicKey string) error {
-	newRecipients := []string{}
+// Without returns a copy of the configuration without a recipient, e.g. to
+// check the rules before removing it.
+func (c *UserConfigType) Without(key string) *UserConfigType {
+	result := *c
+	result.Data.Recipients = []Recipient{}
 	for _, recipient := range c.Data.Recipients {
-		if recipient != publicKey {
+		if recipient.Key != key {
+			result.Data.Recipients = append(result.Data.Recipients, recipient)
+		}
+	}
+	return &result
+}
+
+// RemoveRecipient removes a recipient by key or name.
+func (c *UserConfigType) RemoveRecipient(reference string) (*Recipient, error) {
+	removed := c.FindRecipient(reference)
+	if removed == nil {
+		return nil, fmt.Errorf("recipient not found: %s", reference)
+	}
+	result := *removed
+	newRecipients := []Recipient{}
+	for _, recipient := range c.Data.Recipients {
+		if recipient.Key != result.Key {
 			newRecipients = append(newRecipients, recipient)
 		}
 	}
 	c.Data.Recipients = newRecipients
-	return c.SaveUserConfig()
+	return &result, c.SaveUserConfig()
+}
+
+func (c *UserConfigType) IsProviderAllowed(name string) bool {
+	for _, allowed := range c.Data.Providers.Allow {
+		if allowed == name || allowed == "*" {
+			return true
+		}
+	}
+	return false
 }
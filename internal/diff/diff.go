@@ -0,0 +1,101 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+type Edit struct {
+	Op   Op
+	Text string
+}
+
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Lines computes a minimal line diff from a to b based on the longest common subsequence.
+func Lines(a, b []string) []Edit {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var edits []Edit
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, Edit{Equal, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, Edit{Delete, a[i]})
+			i++
+		default:
+			edits = append(edits, Edit{Insert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, Edit{Delete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, Edit{Insert, b[j]})
+	}
+	return edits
+}
+
+// Format renders the changes with the given number of unchanged lines around them.
+func Format(edits []Edit, context int) string {
+	var builder strings.Builder
+	lastPrinted := -1
+	for i, edit := range edits {
+		if edit.Op == Equal {
+			near := false
+			for k := i - context; k <= i+context; k++ {
+				if k >= 0 && k < len(edits) && edits[k].Op != Equal {
+					near = true
+					break
+				}
+			}
+			if !near {
+				continue
+			}
+		}
+		if lastPrinted >= 0 && i > lastPrinted+1 {
+			builder.WriteString("@@\n")
+		}
+		prefix := " "
+		if edit.Op == Delete {
+			prefix = "-"
+		} else if edit.Op == Insert {
+			prefix = "+"
+		}
+		fmt.Fprintf(&builder, "%s %s\n", prefix, edit.Text)
+		lastPrinted = i
+	}
+	return builder.String()
+}
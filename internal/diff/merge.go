@@ -0,0 +1,146 @@
+package diff
+
+import "strings"
+
+const (
+	ConflictOurs   = "<<<<<<< yours"
+	ConflictBase   = "======="
+	ConflictTheirs = ">>>>>>> theirs"
+)
+
+type hunk struct {
+	start int
+	end   int
+	lines []string
+}
+
+func hunks(edits []Edit) []hunk {
+	var result []hunk
+	var current *hunk
+	i := 0
+	for _, edit := range edits {
+		if edit.Op == Equal {
+			if current != nil {
+				result = append(result, *current)
+				current = nil
+			}
+			i++
+			continue
+		}
+		if current == nil {
+			current = &hunk{start: i, end: i}
+		}
+		if edit.Op == Delete {
+			i++
+			current.end = i
+		} else {
+			current.lines = append(current.lines, edit.Text)
+		}
+	}
+	if current != nil {
+		result = append(result, *current)
+	}
+	return result
+}
+
+func apply(base []string, start, end int, changes []hunk) []string {
+	var result []string
+	pos := start
+	for _, h := range changes {
+		result = append(result, base[pos:h.start]...)
+		result = append(result, h.lines...)
+		pos = h.end
+	}
+	return append(result, base[pos:end]...)
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge3 merges the changes from base to ours and from base to theirs line by
+// line. Conflicting changes are wrapped in conflict markers and reported by
+// returning false.
+func Merge3(base, ours, theirs string) (string, bool) {
+	baseLines := SplitLines(base)
+	oursHunks := hunks(Lines(baseLines, SplitLines(ours)))
+	theirsHunks := hunks(Lines(baseLines, SplitLines(theirs)))
+
+	var result []string
+	clean := true
+	pos := 0
+	for len(oursHunks) > 0 || len(theirsHunks) > 0 {
+		var groupOurs, groupTheirs []hunk
+		var start, end int
+		if len(theirsHunks) == 0 || (len(oursHunks) > 0 && oursHunks[0].start <= theirsHunks[0].start) {
+			start, end = oursHunks[0].start, oursHunks[0].end
+		} else {
+			start, end = theirsHunks[0].start, theirsHunks[0].end
+		}
+
+		// Collect all hunks from both sides overlapping the group
+		for {
+			if len(oursHunks) > 0 && (oursHunks[0].start < end || oursHunks[0].start == start) {
+				if oursHunks[0].end > end {
+					end = oursHunks[0].end
+				}
+				groupOurs = append(groupOurs, oursHunks[0])
+				oursHunks = oursHunks[1:]
+				continue
+			}
+			if len(theirsHunks) > 0 && (theirsHunks[0].start < end || theirsHunks[0].start == start) {
+				if theirsHunks[0].end > end {
+					end = theirsHunks[0].end
+				}
+				groupTheirs = append(groupTheirs, theirsHunks[0])
+				theirsHunks = theirsHunks[1:]
+				continue
+			}
+			break
+		}
+
+		result = append(result, baseLines[pos:start]...)
+		oursLines := apply(baseLines, start, end, groupOurs)
+		theirsLines := apply(baseLines, start, end, groupTheirs)
+		switch {
+		case len(groupTheirs) == 0:
+			result = append(result, oursLines...)
+		case len(groupOurs) == 0:
+			result = append(result, theirsLines...)
+		case equalLines(oursLines, theirsLines):
+			result = append(result, oursLines...)
+		default:
+			clean = false
+			result = append(result, ConflictOurs)
+			result = append(result, oursLines...)
+			result = append(result, ConflictBase)
+			result = append(result, theirsLines...)
+			result = append(result, ConflictTheirs)
+		}
+		pos = end
+	}
+	result = append(result, baseLines[pos:]...)
+
+	merged := strings.Join(result, "\n")
+	if strings.HasSuffix(ours, "\n") && merged != "" {
+		merged += "\n"
+	}
+	return merged, clean
+}
+
+func HasConflicts(text string) bool {
+	for _, line := range SplitLines(text) {
+		if line == ConflictOurs || line == ConflictTheirs {
+			return true
+		}
+	}
+	return false
+}
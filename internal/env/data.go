@@ -0,0 +1,127 @@
+package env
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Variables are edited through yaml.Node so that comments and ordering in
+// Raw are kept.
+
+func (v *DynamicEnvValue) document() (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(v.Raw), &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+		}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("data is not a mapping")
+	}
+	return &doc, nil
+}
+
+func (v *DynamicEnvValue) updateDocument(doc *yaml.Node) error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	encoder.Close()
+
+	data := make(map[string]any)
+	if err := doc.Decode(&data); err != nil {
+		return err
+	}
+	v.Raw = strings.TrimSuffix(buf.String(), "\n")
+	v.Data = data
+	return nil
+}
+
+func mappingValue(mapping *yaml.Node, key string) (int, *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i, mapping.Content[i+1]
+		}
+	}
+	return -1, nil
+}
+
+func newScalarNode(value string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+	if strings.Contains(value, "\n") {
+		node.Style = yaml.LiteralStyle
+	}
+	return node
+}
+
+func (v *DynamicEnvValue) GetVariable(section string, name string) (string, bool, error) {
+	doc, err := v.document()
+	if err != nil {
+		return "", false, err
+	}
+	_, mapping := mappingValue(doc.Content[0], section)
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return "", false, nil
+	}
+	_, node := mappingValue(mapping, name)
+	if node == nil {
+		return "", false, nil
+	}
+	if node.Kind != yaml.ScalarNode {
+		return "", false, fmt.Errorf("%s.%s is not a scalar", section, name)
+	}
+	return node.Value, true, nil
+}
+
+func (v *DynamicEnvValue) SetVariable(section string, name string, value string) error {
+	doc, err := v.document()
+	if err != nil {
+		return err
+	}
+	root := doc.Content[0]
+	_, mapping := mappingValue(root, section)
+	if mapping == nil {
+		mapping = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		root.Content = append(root.Content, newScalarNode(section), mapping)
+	} else if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s is not a mapping", section)
+	}
+
+	if i, node := mappingValue(mapping, name); node != nil {
+		replacement := newScalarNode(value)
+		replacement.HeadComment = node.HeadComment
+		replacement.LineComment = node.LineComment
+		replacement.FootComment = node.FootComment
+		mapping.Content[i+1] = replacement
+	} else {
+		mapping.Content = append(mapping.Content, newScalarNode(name), newScalarNode(value))
+	}
+	return v.updateDocument(doc)
+}
+
+func (v *DynamicEnvValue) UnsetVariable(section string, name string) (bool, error) {
+	doc, err := v.document()
+	if err != nil {
+		return false, err
+	}
+	_, mapping := mappingValue(doc.Content[0], section)
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return false, nil
+	}
+	i, node := mappingValue(mapping, name)
+	if node == nil {
+		return false, nil
+	}
+	mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+	return true, v.updateDocument(doc)
+}
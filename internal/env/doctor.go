@@ -0,0 +1,229 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"denv/internal/config"
+)
+
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+type Check struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Fix     string `json:"fix,omitempty"`
+}
+
+// minimumAgeVersion is the first stable release of age, with SSH recipients
+// and passphrase encryption.
+var minimumAgeVersion = [3]int{1, 0, 0}
+
+var versionPattern = regexp.MustCompile(`v?(\d+)\.(\d+)\.(\d+)`)
+
+func parseVersion(output string) ([3]int, bool) {
+	var version [3]int
+	match := versionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return version, false
+	}
+	for i := range version {
+		version[i], _ = strconv.Atoi(match[i+1])
+	}
+	return version, true
+}
+
+func versionBefore(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func checkAge() Check {
+	check := Check{Name: "age"}
+	path, err := exec.LookPath("age")
+	if err != nil {
+		check.Status, check.Message = CheckFail, "age not found on PATH"
+		check.Fix = "install age from https://github.com/FiloSottile/age"
+		return check
+	}
+	output, err := exec.Command(path, "--version").Output()
+	version, ok := parseVersion(string(output))
+	switch {
+	case err != nil || !ok:
+		check.Status, check.Message = CheckWarn, fmt.Sprintf("%s, unknown version %q", path, strings.TrimSpace(string(output)))
+		check.Fix = "install a release of age"
+	case versionBefore(version, minimumAgeVersion):
+		check.Status, check.Message = CheckFail, fmt.Sprintf("%s is version %s", path, strings.TrimSpace(string(output)))
+		check.Fix = fmt.Sprintf("upgrade age to v%d.%d.%d or newer", minimumAgeVersion[0], minimumAgeVersion[1], minimumAgeVersion[2])
+	default:
+		check.Status, check.Message = CheckPass, fmt.Sprintf("%s %s", path, strings.TrimSpace(string(output)))
+	}
+	return check
+}
+
+func checkAgeKeygen() Check {
+	check := Check{Name: "age-keygen"}
+	path, err := exec.LookPath("age-keygen")
+	if err != nil {
+		check.Status, check.Message = CheckFail, "age-keygen not found on PATH"
+		check.Fix = "install age-keygen, it comes with age"
+		return check
+	}
+	check.Status, check.Message = CheckPass, path
+	return check
+}
+
+// isStreamSource reports identity sources that can only be read once.
+func isStreamSource(source string) bool {
+	return source == "-" || strings.HasPrefix(source, "fd:")
+}
+
+func (d *DynamicEnv) checkIdentitySources() []Check {
+	var checks []Check
+	if d.Config.IdentityData != "" {
+		checks = append(checks, Check{Name: "identity", Status: CheckPass, Message: "inline identity in DENV_IDENTITY"})
+	}
+	explicit := os.Getenv("DENV_IDENTITIES") != ""
+	for _, source := range d.Config.IdentitySources {
+		check := Check{Name: "identity " + source}
+		if isStreamSource(source) {
+			check.Status, check.Message = CheckWarn, "not verified, streams are only read when needed"
+			checks = append(checks, check)
+			continue
+		}
+		info, err := os.Stat(source)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			check.Status, check.Message = CheckPass, "not found, skipped"
+			if explicit {
+				check.Status = CheckWarn
+				check.Fix = "remove it from DENV_IDENTITIES or run denv init"
+			}
+		case err != nil:
+			check.Status, check.Message = CheckFail, err.Error()
+		case info.IsDir():
+			check.Status, check.Message = CheckFail, "is a directory"
+			check.Fix = "point DENV_IDENTITIES to identity files"
+		case info.Mode().Perm()&0077 != 0:
+			check.Status, check.Message = CheckWarn, fmt.Sprintf("readable by other users (%04o)", info.Mode().Perm())
+			check.Fix = "chmod 600 " + source
+		default:
+			if _, err := os.ReadFile(source); err != nil {
+				check.Status, check.Message = CheckFail, err.Error()
+				check.Fix = "make the file readable by you, e.g. chmod 600 " + source
+			} else {
+				check.Status, check.Message = CheckPass, "readable"
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// checkNotWritableByOthers fails for files that other users can change,
+// e.g. to add recipients to config.yml.
+func checkNotWritableByOthers(name string, path string, fix string) Check {
+	check := Check{Name: name}
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		check.Status, check.Message = CheckFail, path+" does not exist"
+		check.Fix = fix
+	case err != nil:
+		check.Status, check.Message = CheckFail, err.Error()
+	case info.Mode().Perm()&0022 != 0:
+		check.Status, check.Message = CheckFail, fmt.Sprintf("%s is writable by other users (%04o)", path, info.Mode().Perm())
+		check.Fix = "chmod go-w " + path
+	default:
+		check.Status, check.Message = CheckPass, fmt.Sprintf("%s (%04o)", path, info.Mode().Perm())
+	}
+	return check
+}
+
+func (d *DynamicEnv) checkRecipients() []Check {
+	check := Check{Name: "recipients"}
+	recipients := d.UserConfig.Data.Recipients
+	if len(recipients) == 0 {
+		check.Status, check.Message = CheckFail, "no recipients in config.yml"
+		check.Fix = "run denv init or denv recipientAdd"
+		return []Check{check}
+	}
+	var invalid []string
+	for _, recipient := range recipients {
+		if err := config.ValidateRecipientKey(recipient.Key); err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s: %v", d.describeRecipient(recipient.Key), err))
+		}
+	}
+	if len(invalid) > 0 {
+		check.Status, check.Message = CheckFail, strings.Join(invalid, "; ")
+		check.Fix = "fix or remove the recipients in config.yml"
+	} else {
+		check.Status, check.Message = CheckPass, fmt.Sprintf("%d recipients", len(recipients))
+	}
+	checks := []Check{check}
+
+	if len(d.UserConfig.Data.Rules) > 0 {
+		rules := Check{Name: "rules", Status: CheckPass, Message: fmt.Sprintf("%d rules", len(d.UserConfig.Data.Rules))}
+		if err := d.UserConfig.CheckRules(); err != nil {
+			rules.Status, rules.Message = CheckFail, err.Error()
+			rules.Fix = "fix the rules in config.yml"
+		}
+		checks = append(checks, rules)
+	}
+	return checks
+}
+
+func (d *DynamicEnv) checkMatchingIdentity() Check {
+	check := Check{Name: "matching identity"}
+	// Reading a stream would consume it or wait for input
+	for _, source := range d.Config.IdentitySources {
+		if isStreamSource(source) {
+			check.Status, check.Message = CheckWarn, "not verified, identities are read from "+source
+			check.Fix = "run denv doctor with DENV_IDENTITIES set to identity files"
+			return check
+		}
+	}
+	if err := d.VerifyIdentities(); err != nil {
+		check.Status, check.Message = CheckFail, err.Error()
+		if recipient, err := d.IdentityRecipient(); err == nil {
+			check.Fix = "ask a recipient to run: denv recipientAdd " + recipient + " && denv reencryptAll"
+		} else {
+			check.Fix = "run denv init, or set DENV_IDENTITIES to your identity"
+		}
+		return check
+	}
+	check.Status, check.Message = CheckPass, "an identity matches a recipient"
+	return check
+}
+
+// Doctor checks the environment denv runs in.
+func (d *DynamicEnv) Doctor() []Check {
+	age, ageKeygen := checkAge(), checkAgeKeygen()
+	checks := []Check{age, ageKeygen}
+	checks = append(checks, d.checkIdentitySources()...)
+	checks = append(checks,
+		checkNotWritableByOthers("root", d.Config.RootDir, "run denv init"),
+		checkNotWritableByOthers("config", filepath.Join(d.Config.RootDir, d.Config.ConfigFile), "run denv init"),
+	)
+	checks = append(checks, d.checkRecipients()...)
+	// Deriving recipients from identities needs the age tools
+	if age.Status != CheckFail && ageKeygen.Status != CheckFail {
+		checks = append(checks, d.checkMatchingIdentity())
+	}
+	return checks
+}
@@ -1,6 +1,8 @@
 package env
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
@@ -31,28 +33,61 @@ import (
 
 type DynamicEnvMetadata struct {
 	ID string `yaml:"id"`
+	// Variables considered secret, all variables are secret if empty
+	Secret []string `yaml:"secret,omitempty"`
+	// Encrypted with a passphrase instead of the recipients
+	Passphrase bool `yaml:"passphrase,omitempty"`
 }
 type DynamicEnvValue struct {
 	Metadata DynamicEnvMetadata
 	Raw      string
 	Data     map[string]any
 	Payload  string
+	// Hash of the encrypted file the value was loaded from, empty for new values
+	Revision string
+}
+
+type ConflictError struct {
+	Key string
+}
+
+func (e *ConflictError) Error() string {
+	return "key was changed since it was read: " + e.Key
+}
+
+func revisionOf(encrypted string) string {
+	sum := sha256.Sum256([]byte(encrypted))
+	return hex.EncodeToString(sum[:])
 }
 
 type DynamicEnv struct {
 	Config      *config.ConfigType
 	UserConfig  *config.UserConfigType
+	Project     *config.ProjectConfigType
 	Filehandler *filehandler.FileHandler
 	index       *map[string]string
+
+	providerCache map[string]string
+	fileDir       string
+	fileScope     string
+	keepFiles     bool
+
+	identities    []identity
+	identityFiles []string
+	identityDir   string
 }
 
 type DynamicEnvParsed struct {
-	Local map[string]string
-	Env   map[string]string
+	Local  map[string]string
+	Env    map[string]string
+	Files  map[string]string
+	Secret map[string]bool
+	// Data files the env is loaded from, including extended ones
+	Sources []string
 }
 
-func NewDynamicEnv(config *config.ConfigType, userConfig *config.UserConfigType, filehandler *filehandler.FileHandler) *DynamicEnv {
-	return &DynamicEnv{Config: config, UserConfig: userConfig, Filehandler: filehandler}
+func NewDynamicEnv(config *config.ConfigType, userConfig *config.UserConfigType, project *config.ProjectConfigType, filehandler *filehandler.FileHandler) *DynamicEnv {
+	return &DynamicEnv{Config: config, UserConfig: userConfig, Project: project, Filehandler: filehandler}
 }
 
 func (d *DynamicEnv) GetFilePath(path string) string {
@@ -73,17 +108,13 @@ func (d *DynamicEnv) ParseRawValue(value string, includeMetadata bool) (*Dynamic
 			return nil, errors.New("invalid YAML content: missing metadata separator")
 		}
 
-		rawMetadata := make(map[string]any)
-		if err := yaml.Unmarshal([]byte(strings.Join(lines[:i], "\n")), &rawMetadata); err != nil {
+		if err := yaml.Unmarshal([]byte(strings.Join(lines[:i], "\n")), &metadata); err != nil {
 			return nil, errors.New("invalid metadata: " + err.Error())
 		}
 
-		id, ok := rawMetadata["id"].(string)
-		if !ok || id == "" {
+		if metadata.ID == "" {
 			return nil, errors.New("invalid metadata: missing or invalid 'id'")
 		}
-
-		metadata.ID = id
 	}
 
 	j := indexOf(lines, "---", i+1)
@@ -142,12 +173,16 @@ func (d *DynamicEnv) FormatValue(value *DynamicEnvValue, includeMetadata bool) (
 }
 
 func (d *DynamicEnv) EncryptData(data string) (string, error) {
-	if len(d.UserConfig.Data.Recipients) == 0 {
+	return d.EncryptDataTo(data, d.UserConfig.RecipientKeys())
+}
+
+func (d *DynamicEnv) EncryptDataTo(data string, recipients []string) (string, error) {
+	if len(recipients) == 0 {
 		return "", errors.New("no recipient is added")
 	}
 
 	args := []string{"-a"}
-	for _, recipient := range d.UserConfig.Data.Recipients {
+	for _, recipient := range recipients {
 		args = append(args, "-r", recipient)
 	}
 
@@ -163,11 +198,22 @@ func (d *DynamicEnv) EncryptData(data string) (string, error) {
 }
 
 func (d *DynamicEnv) DecryptData(data string) (string, error) {
-	if d.Config.Identities == "" {
-		return "", errors.New("no identities file provided")
+	// age asks for the passphrase on the terminal and refuses identities
+	if IsPassphraseProtected(data) {
+		return decryptWith(data, nil)
+	}
+	files, err := d.IdentityFiles()
+	if err != nil {
+		return "", err
 	}
+	return decryptWith(data, files)
+}
 
-	args := []string{"--decrypt", "-i", d.Config.Identities}
+func decryptWith(data string, identityFiles []string) (string, error) {
+	args := []string{"--decrypt"}
+	for _, file := range identityFiles {
+		args = append(args, "-i", file)
+	}
 
 	cmd := exec.Command("age", args...)
 	cmd.Stdin = strings.NewReader(data)
@@ -186,7 +232,11 @@ func (d *DynamicEnv) LoadValue(encrypted string) (*DynamicEnvValue, error) {
 		return nil, errors.New("failed to decrypt data: " + err.Error())
 	}
 	dynamicEnvValue, err := d.ParseRawValue(value, true)
-	return dynamicEnvValue, err
+	if err != nil {
+		return nil, err
+	}
+	dynamicEnvValue.Revision = revisionOf(encrypted)
+	return dynamicEnvValue, nil
 }
 
 func (d *DynamicEnv) ListEnvFiles(prefix string) ([]string, error) {
@@ -204,13 +254,22 @@ func (d *DynamicEnv) ListEnvFiles(prefix string) ([]string, error) {
 }
 
 func (d *DynamicEnv) ListItems(prefix string) map[string]*DynamicEnvValue {
+	envs, _ := d.listItems(prefix)
+	return envs
+}
+
+// listItems also returns the files that can't be decrypted or parsed, e.g.
+// because a rule doesn't include this machine. Passphrase protected files
+// are not included.
+func (d *DynamicEnv) listItems(prefix string) (map[string]*DynamicEnvValue, []string) {
 	envs := make(map[string]*DynamicEnvValue)
+	var skipped []string
 	files, err := d.ListEnvFiles(prefix)
 	if err != nil {
 		if d.Config.Debug {
 			log.Printf("Error listing files: %v\n", err)
 		}
-		return envs
+		return envs, nil
 	}
 
 	for _, file := range files {
@@ -224,17 +283,24 @@ func (d *DynamicEnv) ListItems(prefix string) map[string]*DynamicEnvValue {
 			}
 			continue
 		}
+		if IsPassphraseProtected(value) {
+			if d.Config.Debug {
+				log.Printf("Skipping passphrase protected file %s\n", file)
+			}
+			continue
+		}
 		dynamicEnvValue, err := d.LoadValue(value)
 		if err != nil {
 			if d.Config.Debug {
 				log.Printf("Error parsing file %s: %v\n", file, err)
 			}
+			skipped = append(skipped, file)
 			continue
 		}
 		uid := strings.TrimSuffix(file, d.Config.EnvSuffix)
 		envs[uid] = dynamicEnvValue
 	}
-	return envs
+	return envs, skipped
 }
 
 func (d *DynamicEnv) LoadIndex() *map[string]string {
@@ -265,6 +331,13 @@ func (d *DynamicEnv) SaveIndex(index *map[string]string) error {
 func (d *DynamicEnv) BuildIndex() error {
 	envs := d.ListItems("")
 	index := make(map[string]string)
+	// Passphrase protected files are not decrypted, keep their entries
+	for uid, key := range *d.LoadIndex() {
+		data, err := d.Filehandler.ReadFile(d.GetEnvPath(uid))
+		if err == nil && IsPassphraseProtected(data) {
+			index[uid] = key
+		}
+	}
 	for uid, value := range envs {
 		index[uid] = value.Metadata.ID
 	}
@@ -325,31 +398,97 @@ func (d *DynamicEnv) SetEnv(key string, value *DynamicEnvValue) error {
 	}
 
 	keyFrom := value.Metadata.ID
-	value.Metadata.ID = key
-
 	uid, err := d.GetEnvUID(keyFrom)
 	if err != nil {
 		return err
 	}
 
+	path := d.GetEnvPath(uid)
+	if value.Revision != "" {
+		current, err := d.Filehandler.ReadFile(path)
+		if err != nil || revisionOf(current) != value.Revision {
+			return &ConflictError{Key: keyFrom}
+		}
+	}
+
+	value.Metadata.ID = key
 	data, err := d.FormatValue(value, true)
 	if err != nil {
 		return err
 	}
 
-	encrypted, err := d.EncryptData(data)
+	var encrypted string
+	if value.Metadata.Passphrase {
+		fmt.Fprintln(os.Stderr, "Enter the passphrase for", key)
+		encrypted, err = d.EncryptWithPassphrase(data)
+	} else {
+		var recipients []string
+		var rule *config.RecipientRule
+		recipients, rule, err = d.UserConfig.RecipientsFor(key)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if d.Config.Debug && rule != nil {
+			log.Printf("Encrypting %s for rule %s\n", key, rule.Path)
+		}
+		encrypted, err = d.EncryptDataTo(data, recipients)
+	}
 	if err != nil {
-		return err
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	if encrypted == "" {
+		return fmt.Errorf("%s: encryption returned no data", key)
 	}
 
-	path := d.GetEnvPath(uid)
 	if err := d.Filehandler.WriteFile(path, encrypted); err != nil {
 		return err
 	}
+	value.Revision = revisionOf(encrypted)
 
 	return d.UpdateIndex(uid, key, keyFrom)
 }
 
+func (d *DynamicEnv) keyExists(key string) bool {
+	for _, id := range *d.LoadIndex() {
+		if id == key {
+			return true
+		}
+	}
+	return false
+}
+
+// RenameEnv moves the value of key to newKey, which must not exist.
+func (d *DynamicEnv) RenameEnv(key string, newKey string) error {
+	if d.keyExists(newKey) {
+		return fmt.Errorf("key already exists: %s", newKey)
+	}
+	value, err := d.GetEnv(key)
+	if err != nil {
+		return err
+	}
+	return d.SetEnv(newKey, value)
+}
+
+// CopyEnv stores the value of key as newKey. An existing newKey is only
+// replaced when overwrite is set.
+func (d *DynamicEnv) CopyEnv(key string, newKey string, overwrite bool) error {
+	value, err := d.GetEnv(key)
+	if err != nil {
+		return err
+	}
+	// Store as a new value instead of moving the existing one
+	value.Metadata.ID = ""
+	value.Revision = ""
+	if d.keyExists(newKey) {
+		if !overwrite {
+			return fmt.Errorf("key already exists: %s", newKey)
+		}
+		// Replace the file of the existing key to keep one index entry
+		value.Metadata.ID = newKey
+	}
+	return d.SetEnv(newKey, value)
+}
+
 func (d *DynamicEnv) DeleteEnv(key string) error {
 	uid, err := d.GetEnvUID(key)
 	if err != nil {
@@ -378,7 +517,12 @@ func (d *DynamicEnv) ParseEnv(key string) (*DynamicEnvParsed, error) {
 		return nil, errors.New("data not found: " + key)
 	}
 
-	result := DynamicEnvParsed{Local: make(map[string]string), Env: make(map[string]string)}
+	result := newDynamicEnvParsed()
+	uid, err := d.GetEnvUID(key)
+	if err != nil {
+		return nil, err
+	}
+	result.Sources = append(result.Sources, d.GetEnvPath(uid))
 
 	if extends, ok := parsed.Data["extends"].([]any); ok {
 		for _, dep := range extends {
@@ -390,30 +534,91 @@ func (d *DynamicEnv) ParseEnv(key string) (*DynamicEnvParsed, error) {
 			if err != nil {
 				return nil, err
 			}
-			for k, v := range parsedDep.Local {
-				result.Local[k] = v
+			result.merge(parsedDep)
+		}
+	}
+
+	sections, err := dataSections(parsed.Raw, "local", "files", "oauth2", "env")
+	if err != nil {
+		return nil, fmt.Errorf("invalid data in %s: %w", key, err)
+	}
+
+	if local := sections["local"]; local != nil {
+		for i := 0; i+1 < len(local.Content); i += 2 {
+			value, err := d.resolveNode(local.Content[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("%s: local.%s: %w", key, local.Content[i].Value, err)
 			}
-			for k, v := range parsedDep.Env {
-				result.Env[k] = v
+			result.Local[local.Content[i].Value] = value
+		}
+	}
+
+	if parsed.Payload != "" {
+		result.Files[payloadFile] = parsed.Payload
+	}
+
+	if files := sections["files"]; files != nil {
+		for i := 0; i+1 < len(files.Content); i += 2 {
+			value, err := d.resolveNode(files.Content[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("%s: files.%s: %w", key, files.Content[i].Value, err)
 			}
+			result.Files[files.Content[i].Value] = value
 		}
 	}
 
-	if local, ok := parsed.Data["local"].(map[string]any); ok {
-		for k, v := range local {
-			result.Local[k] = fmt.Sprintf("%v", v)
+	if oauth2 := sections["oauth2"]; oauth2 != nil {
+		tokens, err := d.resolveOAuth2(oauth2, result.Local)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		for k, v := range tokens {
+			result.Local[k] = v
+			result.Env[k] = v
+			result.Secret[k] = isSecret(parsed.Metadata, k)
 		}
 	}
 
-	if env, ok := parsed.Data["env"].(map[string]any); ok {
-		for k, v := range env {
-			value := fmt.Sprintf("%v", v)
-			resolved := resolveEnvVariables(value, result.Local)
-			result.Env[k] = resolved
+	if env := sections["env"]; env != nil {
+		for i := 0; i+1 < len(env.Content); i += 2 {
+			k, node := env.Content[i].Value, env.Content[i+1]
+			value, err := d.resolveNode(node)
+			if err != nil {
+				return nil, fmt.Errorf("%s: env.%s: %w", key, k, err)
+			}
+			// Values from providers are used verbatim
+			if _, isProvider := providerName(node.Tag); !isProvider {
+				value, err = d.expandEnvValue(value, result, uid)
+				if err != nil {
+					return nil, fmt.Errorf("%s: env.%s: %w", key, k, err)
+				}
+			}
+			result.Env[k] = value
+			result.Secret[k] = isSecret(parsed.Metadata, k)
 		}
 	}
 
-	return &result, nil
+	return result, nil
+}
+
+func dataSections(raw string, names ...string) (map[string]*yaml.Node, error) {
+	sections := make(map[string]*yaml.Node)
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(raw), &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return sections, nil
+	}
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		for _, name := range names {
+			if root.Content[i].Value == name && root.Content[i+1].Kind == yaml.MappingNode {
+				sections[name] = root.Content[i+1]
+			}
+		}
+	}
+	return sections, nil
 }
 
 func resolveEnvVariables(value string, local map[string]string) string {
@@ -428,34 +633,89 @@ func resolveEnvVariables(value string, local map[string]string) string {
 	})
 }
 
-func (d *DynamicEnv) GetEnvs(keys []string) map[string]string {
-	envs := make(map[string]string)
+func newDynamicEnvParsed() *DynamicEnvParsed {
+	return &DynamicEnvParsed{
+		Local:  make(map[string]string),
+		Env:    make(map[string]string),
+		Files:  make(map[string]string),
+		Secret: make(map[string]bool),
+	}
+}
+
+func (p *DynamicEnvParsed) merge(other *DynamicEnvParsed) {
+	for k, v := range other.Local {
+		p.Local[k] = v
+	}
+	for k, v := range other.Env {
+		p.Env[k] = v
+	}
+	for k, v := range other.Files {
+		p.Files[k] = v
+	}
+	for k, v := range other.Secret {
+		p.Secret[k] = v
+	}
+	p.Sources = append(p.Sources, other.Sources...)
+}
+
+func isSecret(metadata DynamicEnvMetadata, name string) bool {
+	if len(metadata.Secret) == 0 {
+		return true
+	}
+	for _, secret := range metadata.Secret {
+		if secret == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *DynamicEnv) ParseEnvs(keys []string) *DynamicEnvParsed {
+	result := newDynamicEnvParsed()
 	for _, key := range keys {
 		parsed, err := d.ParseEnv(key)
 		if err != nil {
-			if d.Config.Debug {
-				log.Printf("Error parsing env %s: %v\n", key, err)
-			}
+			// The command still runs, so say which variables are missing
+			fmt.Fprintf(os.Stderr, "denv: skipping %s: %v\n", key, err)
 			continue
 		}
-		for k, v := range parsed.Env {
-			envs[k] = v
+		result.merge(parsed)
+	}
+	return result
+}
+
+func (d *DynamicEnv) GetEnvs(keys []string) map[string]string {
+	return d.ParseEnvs(keys).Env
+}
+
+func (p *DynamicEnvParsed) SecretEnvs() map[string]string {
+	secrets := make(map[string]string)
+	for k, v := range p.Env {
+		if p.Secret[k] {
+			secrets[k] = v
 		}
 	}
-	return envs
+	return secrets
 }
 
 func (d *DynamicEnv) VerifyIdentities() error {
-	cmd := exec.Command("age-keygen", "-y", d.Config.Identities)
-	output, err := cmd.Output()
+	files, err := d.IdentityFiles()
 	if err != nil {
-		return fmt.Errorf("failed to verify identities: %w", err)
+		return err
+	}
+	var identities []string
+	for _, file := range files {
+		// e.g. passphrase protected SSH keys without a .pub file
+		recipients, err := identityRecipients(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping identity %v\n", err)
+			continue
+		}
+		identities = append(identities, recipients...)
 	}
-
-	identities := strings.Split(strings.TrimSpace(string(output)), "\n")
 
 	for _, identity := range identities {
-		for _, recipient := range d.UserConfig.Data.Recipients {
+		for _, recipient := range d.UserConfig.RecipientKeys() {
 			if identity == recipient {
 				return nil
 			}
@@ -465,17 +725,20 @@ func (d *DynamicEnv) VerifyIdentities() error {
 	return errors.New("no matching identity found in recipients")
 }
 
-func (d *DynamicEnv) ReencryptAll() error {
+// ReencryptAll encrypts all keys to their current recipients. It returns the
+// files that were skipped because they can't be decrypted.
+func (d *DynamicEnv) ReencryptAll() ([]string, error) {
 	err := d.VerifyIdentities()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	envs := d.ListItems("")
+	envs, skipped := d.listItems("")
+	values := make([]*DynamicEnvValue, 0, len(envs))
 	for _, value := range envs {
-		d.SetEnv(value.Metadata.ID, value)
+		values = append(values, value)
 	}
-	return nil
+	return skipped, d.Reencrypt(values)
 }
 
 func (d *DynamicEnv) ExportTree(outDir string, prefix string) ([]string, error) {
@@ -532,3 +795,13 @@ func (d *DynamicEnv) ImportTree(inDir string, prefix string) ([]string, error) {
 	}
 	return keys, nil
 }
+
+// Reload drops cached state so that changes on disk are picked up.
+func (d *DynamicEnv) Reload() error {
+	d.index = nil
+	d.providerCache = nil
+	if d.Project.Path != "" {
+		return d.Project.LoadProjectConfig()
+	}
+	return nil
+}
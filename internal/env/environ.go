@@ -0,0 +1,79 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"denv/internal/config"
+)
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func inheritVariable(name string, options config.EnvironmentConfig) bool {
+	if matchAny(options.Keep, name) {
+		return true
+	}
+	if matchAny(options.Deny, name) {
+		return false
+	}
+	if options.Project != nil && !inheritVariable(name, *options.Project) {
+		return false
+	}
+	if options.Clean || len(options.Allow) > 0 {
+		return matchAny(options.Allow, name)
+	}
+	return true
+}
+
+// BuildEnviron filters the inherited environment and appends the resolved variables.
+func BuildEnviron(base []string, vars map[string]string, options config.EnvironmentConfig) []string {
+	environ := []string{}
+	for _, item := range base {
+		name := strings.SplitN(item, "=", 2)[0]
+		if _, ok := vars[name]; ok {
+			continue
+		}
+		if inheritVariable(name, options) {
+			environ = append(environ, item)
+		}
+	}
+
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		environ = append(environ, key+"="+vars[key])
+	}
+	return environ
+}
+
+func (d *DynamicEnv) EnvironmentOptions() config.EnvironmentConfig {
+	return d.UserConfig.Data.Environment.Merge(d.Project.Data.Environment)
+}
+
+// ResolveKeys falls back to the keys of the project manifest when none is given.
+// The manifest is found in any parent directory, so its keys are only used
+// when it is trusted.
+func (d *DynamicEnv) ResolveKeys(keys []string) []string {
+	if len(keys) == 0 && len(d.Project.Data.Keys) > 0 {
+		if !d.Project.IsTrusted(d.UserConfig) {
+			fmt.Fprintf(os.Stderr, "denv: ignoring the keys of %s, run denv trust to use them\n", d.Project.Path)
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "denv: using keys %s from %s\n", strings.Join(d.Project.Data.Keys, ", "), d.Project.Path)
+		return d.Project.Data.Keys
+	}
+	return keys
+}
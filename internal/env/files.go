@@ -0,0 +1,101 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"denv/internal/tmpfs"
+)
+
+/*
+ * Secret files are declared in the `files` section, the payload is available
+ * as a file named `payload`. They are written to a private directory, with a
+ * subdirectory per key, when referenced as `${file:name}`:
+ *
+ * ```
+ * files:
+ *   kubeconfig: |
+ *     apiVersion: v1
+ * env:
+ *   KUBECONFIG: ${file:kubeconfig}
+ * ```
+ */
+
+const filePrefix = "file:"
+
+const payloadFile = "payload"
+
+func (d *DynamicEnv) materializeFile(uid string, name string, content string) (string, error) {
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid file name: %q", name)
+	}
+	if d.fileDir == "" {
+		dir, err := tmpfs.MkdirPrivate("denv-*")
+		if err != nil {
+			return "", fmt.Errorf("failed to create directory for files: %w", err)
+		}
+		d.fileDir = dir
+	}
+	// Keys and processes may use files with the same name
+	dir := filepath.Join(d.fileDir, d.fileScope, uid)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create directory for files: %w", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// SetFileScope writes the following files to their own subdirectory, e.g.
+// for each process of up.
+func (d *DynamicEnv) SetFileScope(scope string) {
+	d.fileScope = scope
+}
+
+func (d *DynamicEnv) FileDir() string {
+	return d.fileDir
+}
+
+func (d *DynamicEnv) CleanupFiles() error {
+	if d.fileDir == "" {
+		return nil
+	}
+	err := tmpfs.ShredAll(d.fileDir)
+	d.fileDir = ""
+	return err
+}
+
+func (d *DynamicEnv) expandEnvValue(value string, parsed *DynamicEnvParsed, uid string) (string, error) {
+	var expandErr error
+	result := os.Expand(value, func(variable string) string {
+		if variable == "$" {
+			return "$"
+		}
+		if strings.HasPrefix(variable, filePrefix) {
+			name := strings.TrimPrefix(variable, filePrefix)
+			content, ok := parsed.Files[name]
+			if !ok {
+				expandErr = fmt.Errorf("file not found: %s", name)
+				return ""
+			}
+			path, err := d.materializeFile(uid, name, content)
+			if err != nil {
+				expandErr = err
+			}
+			return path
+		}
+		if strings.HasPrefix(variable, totpPrefix) {
+			code, err := totpCode(strings.TrimPrefix(variable, totpPrefix), parsed)
+			if err != nil {
+				expandErr = err
+			}
+			return code
+		}
+		return parsed.Local[variable]
+	})
+	return result, expandErr
+}
@@ -0,0 +1,128 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+/*
+ * init sets a machine up: it generates or imports an identity into the
+ * identities file, adds its recipient to config.yml and checks that data
+ * encrypted to the recipient can be decrypted again.
+ */
+
+// HasIdentity reports whether an identity is available without generating
+// one, either inline in DENV_IDENTITY or in the identities file.
+func (d *DynamicEnv) HasIdentity() bool {
+	if d.Config.IdentityData != "" {
+		return true
+	}
+	_, err := os.Stat(d.Config.Identities)
+	return err == nil
+}
+
+// WriteIdentity writes a new identities file readable only by the user.
+func (d *DynamicEnv) WriteIdentity(content string) error {
+	file := d.Config.Identities
+	if file == "" {
+		return errors.New("no identity file in DENV_IDENTITIES")
+	}
+	if _, err := os.Stat(file); err == nil {
+		return fmt.Errorf("identity file %s already exists", file)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", file, err)
+	}
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	// O_EXCL so that an identity created in the meantime is never overwritten
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", file, err)
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return f.Close()
+}
+
+// UseIdentityFile makes sure the identities file is tried first, e.g. after
+// init wrote it.
+func (d *DynamicEnv) UseIdentityFile() {
+	sources := []string{d.Config.Identities}
+	for _, source := range d.Config.IdentitySources {
+		if source != d.Config.Identities {
+			sources = append(sources, source)
+		}
+	}
+	d.Config.IdentitySources = sources
+	d.CleanupIdentities()
+	d.identities = nil
+}
+
+// IdentityRecipient returns the recipient of the first identity that has one.
+func (d *DynamicEnv) IdentityRecipient() (string, error) {
+	files, err := d.IdentityFiles()
+	if err != nil {
+		return "", err
+	}
+	err = errors.New("no identity found")
+	for _, file := range files {
+		var recipients []string
+		recipients, err = identityRecipients(file)
+		if err != nil {
+			continue
+		}
+		if len(recipients) == 0 || recipients[0] == "" {
+			err = fmt.Errorf("no identity found in %s", file)
+			continue
+		}
+		return recipients[0], nil
+	}
+	return "", err
+}
+
+// SecurePermissions restricts the root directory and the identities file to
+// the user.
+func (d *DynamicEnv) SecurePermissions() error {
+	if err := os.MkdirAll(d.Config.RootDir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", d.Config.RootDir, err)
+	}
+	if err := os.Chmod(d.Config.RootDir, 0700); err != nil {
+		return err
+	}
+	if _, err := os.Stat(d.Config.Identities); err == nil {
+		if err := os.Chmod(d.Config.Identities, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckRoundTrip encrypts a random value to the recipient and decrypts it
+// with the identities.
+func (d *DynamicEnv) CheckRoundTrip(recipient string) error {
+	value, err := gonanoid.New()
+	if err != nil {
+		return err
+	}
+	encrypted, err := d.EncryptDataTo(value, []string{recipient})
+	if err != nil {
+		return err
+	}
+	decrypted, err := d.DecryptData(encrypted)
+	if err != nil {
+		return err
+	}
+	if decrypted != value {
+		return errors.New("decrypted value does not match")
+	}
+	return nil
+}
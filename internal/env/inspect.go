@@ -0,0 +1,180 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"denv/internal/agefile"
+)
+
+const (
+	InspectOK          = "ok"
+	InspectOverShared  = "over-shared"
+	InspectUnderShared = "under-shared"
+	InspectStale       = "stale"
+	InspectUnindexed   = "unindexed"
+	InspectInvalid     = "invalid"
+)
+
+type Inspection struct {
+	Key        string
+	UID        string
+	Stanzas    []agefile.Stanza
+	Expected   []string
+	Missing    []string
+	Extra      []string
+	Status     string
+	Passphrase bool
+	Err        error
+}
+
+func isX25519Recipient(recipient string) bool {
+	return strings.HasPrefix(recipient, "age1") && len(recipient) == 62
+}
+
+func isSSHRecipient(recipient string) bool {
+	return strings.HasPrefix(recipient, "ssh-ed25519 ") || strings.HasPrefix(recipient, "ssh-rsa ")
+}
+
+func (d *DynamicEnv) describeRecipient(key string) string {
+	if recipient := d.UserConfig.FindRecipient(key); recipient != nil && recipient.Name != "" {
+		return recipient.Name
+	}
+	if len(key) > 24 {
+		return key[:20] + "…"
+	}
+	return key
+}
+
+func countDifference(kind string, expected int, actual int, inspection *Inspection) {
+	if actual < expected {
+		inspection.Missing = append(inspection.Missing, fmt.Sprintf("%d %s", expected-actual, kind))
+	} else if actual > expected {
+		inspection.Extra = append(inspection.Extra, fmt.Sprintf("%d %s", actual-expected, kind))
+	}
+}
+
+// compare matches the stanzas of a file with the configured recipients.
+// X25519 and plugin recipients can only be compared by count.
+func (d *DynamicEnv) compare(inspection *Inspection) {
+	expectedX25519, expectedPlugin := 0, 0
+	expectedTags := make(map[string]string)
+	for _, recipient := range inspection.Expected {
+		switch {
+		case isX25519Recipient(recipient):
+			expectedX25519++
+		case isSSHRecipient(recipient):
+			if tag, err := agefile.SSHTag(recipient); err == nil {
+				expectedTags[tag] = recipient
+			}
+		default:
+			expectedPlugin++
+		}
+	}
+
+	actualX25519, actualPlugin := 0, 0
+	actualTags := make(map[string]bool)
+	for _, stanza := range inspection.Stanzas {
+		switch {
+		case stanza.Type == "X25519":
+			actualX25519++
+		case stanza.Tag() != "":
+			actualTags[stanza.Tag()] = true
+			if _, ok := expectedTags[stanza.Tag()]; !ok {
+				inspection.Extra = append(inspection.Extra, stanza.Type+" "+stanza.Tag())
+			}
+		default:
+			actualPlugin++
+		}
+	}
+	for tag, recipient := range expectedTags {
+		if !actualTags[tag] {
+			inspection.Missing = append(inspection.Missing, d.describeRecipient(recipient))
+		}
+	}
+	sort.Strings(inspection.Missing)
+	countDifference("X25519", expectedX25519, actualX25519, inspection)
+	countDifference("plugin", expectedPlugin, actualPlugin, inspection)
+
+	switch {
+	case len(inspection.Missing) > 0 && len(inspection.Extra) > 0:
+		inspection.Status = InspectStale
+	case len(inspection.Extra) > 0:
+		inspection.Status = InspectOverShared
+	case len(inspection.Missing) > 0:
+		inspection.Status = InspectUnderShared
+	default:
+		inspection.Status = InspectOK
+	}
+}
+
+func (d *DynamicEnv) inspectFile(uid string, key string) *Inspection {
+	inspection := &Inspection{Key: key, UID: uid}
+	data, err := d.Filehandler.ReadFile(d.GetEnvPath(uid))
+	if err != nil {
+		inspection.Status, inspection.Err = InspectInvalid, err
+		return inspection
+	}
+	header, err := agefile.ParseHeader([]byte(data))
+	if err != nil {
+		inspection.Status, inspection.Err = InspectInvalid, err
+		return inspection
+	}
+	inspection.Stanzas = header.Recipients()
+
+	// Passphrase protected files have no recipients to compare
+	for _, stanza := range inspection.Stanzas {
+		if stanza.Type == "scrypt" {
+			inspection.Passphrase = true
+			inspection.Status = InspectOK
+			return inspection
+		}
+	}
+	if key == "" {
+		inspection.Status = InspectUnindexed
+		return inspection
+	}
+	inspection.Expected, _, err = d.UserConfig.RecipientsFor(key)
+	if err != nil {
+		inspection.Status, inspection.Err = InspectInvalid, err
+		return inspection
+	}
+	d.compare(inspection)
+	return inspection
+}
+
+// InspectEnv compares the header of the file of a key with its configured
+// recipients, without decrypting it.
+func (d *DynamicEnv) InspectEnv(key string) (*Inspection, error) {
+	for uid, id := range *d.LoadIndex() {
+		if id == key {
+			return d.inspectFile(uid, key), nil
+		}
+	}
+	return nil, errors.New("key not found in the index: " + key)
+}
+
+func (d *DynamicEnv) InspectAll() ([]*Inspection, error) {
+	files, err := d.ListEnvFiles("")
+	if err != nil {
+		return nil, err
+	}
+	index := *d.LoadIndex()
+	var inspections []*Inspection
+	for _, file := range files {
+		if !strings.HasSuffix(file, d.Config.EnvSuffix) {
+			continue
+		}
+		uid := strings.TrimSuffix(file, d.Config.EnvSuffix)
+		inspections = append(inspections, d.inspectFile(uid, index[uid]))
+	}
+	sort.Slice(inspections, func(i, j int) bool {
+		if inspections[i].Key != inspections[j].Key {
+			return inspections[i].Key < inspections[j].Key
+		}
+		return inspections[i].UID < inspections[j].UID
+	})
+	return inspections, nil
+}
@@ -0,0 +1,226 @@
+package env
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * OAuth2 client credentials are declared in the `oauth2` section, the access
+ * token is exposed as a variable named by the entry:
+ *
+ * ```
+ * local:
+ *   secret: xxx
+ * oauth2:
+ *   API_TOKEN:
+ *     token_url: https://auth.example.com/oauth/token
+ *     client_id: my-client
+ *     client_secret: ${secret}
+ *     scopes: [read, write]
+ *     audience: https://api.example.com
+ * ```
+ *
+ * Tokens are cached under `temp/tokens`, encrypted to your own identity only,
+ * until shortly before they expire.
+ */
+
+const tokenCacheDir = "temp/tokens"
+
+const tokenExpiryLeeway = time.Minute
+
+type OAuth2Config struct {
+	TokenURL     string   `yaml:"token_url"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+	Audience     string   `yaml:"audience"`
+	AuthStyle    string   `yaml:"auth_style"`
+}
+
+type oauth2Token struct {
+	AccessToken string    `yaml:"access_token"`
+	ExpiresAt   time.Time `yaml:"expires_at"`
+}
+
+type oauth2Response struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (c *OAuth2Config) expand(local map[string]string) {
+	c.TokenURL = resolveEnvVariables(c.TokenURL, local)
+	c.ClientID = resolveEnvVariables(c.ClientID, local)
+	c.ClientSecret = resolveEnvVariables(c.ClientSecret, local)
+	c.Audience = resolveEnvVariables(c.Audience, local)
+	for i, scope := range c.Scopes {
+		c.Scopes[i] = resolveEnvVariables(scope, local)
+	}
+}
+
+func (c *OAuth2Config) cacheKey() string {
+	hash := sha256.New()
+	for _, part := range []string{c.TokenURL, c.ClientID, c.ClientSecret, strings.Join(c.Scopes, " "), c.Audience} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (d *DynamicEnv) resolveOAuth2(section *yaml.Node, local map[string]string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	for i := 0; i+1 < len(section.Content); i += 2 {
+		name := section.Content[i].Value
+		if !d.UserConfig.IsProviderAllowed("oauth2") {
+			return nil, fmt.Errorf("oauth2.%s: provider oauth2 is not allowed, add it to providers.allow in %s", name, d.Config.ConfigFile)
+		}
+		var config OAuth2Config
+		if err := section.Content[i+1].Decode(&config); err != nil {
+			return nil, fmt.Errorf("oauth2.%s: %w", name, err)
+		}
+		config.expand(local)
+		token, err := d.GetOAuth2Token(&config)
+		if err != nil {
+			return nil, fmt.Errorf("oauth2.%s: %w", name, err)
+		}
+		tokens[name] = token
+	}
+	return tokens, nil
+}
+
+func (d *DynamicEnv) GetOAuth2Token(config *OAuth2Config) (string, error) {
+	if config.TokenURL == "" || config.ClientID == "" {
+		return "", errors.New("token_url and client_id are required")
+	}
+
+	cachePath := path.Join(tokenCacheDir, config.cacheKey()+d.Config.EnvSuffix)
+	if token, err := d.loadCachedToken(cachePath); err == nil {
+		return token.AccessToken, nil
+	} else if d.Config.Debug {
+		log.Printf("No cached token: %v\n", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.providerTimeout())
+	defer cancel()
+	token, err := fetchOAuth2Token(ctx, config)
+	if err != nil {
+		return "", err
+	}
+
+	if err := d.saveCachedToken(cachePath, token); err != nil && d.Config.Debug {
+		log.Printf("Error caching token: %v\n", err)
+	}
+	return token.AccessToken, nil
+}
+
+func (d *DynamicEnv) loadCachedToken(path string) (*oauth2Token, error) {
+	encrypted, err := d.Filehandler.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.DecryptData(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	var token oauth2Token
+	if err := yaml.Unmarshal([]byte(data), &token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" || !time.Now().Add(tokenExpiryLeeway).Before(token.ExpiresAt) {
+		return nil, errors.New("token expired")
+	}
+	return &token, nil
+}
+
+func (d *DynamicEnv) saveCachedToken(path string, token *oauth2Token) error {
+	if token.ExpiresAt.IsZero() {
+		return nil
+	}
+	data, err := yaml.Marshal(token)
+	if err != nil {
+		return err
+	}
+	// The cache is only for this machine, not for the other recipients
+	recipient, err := d.IdentityRecipient()
+	if err != nil {
+		return err
+	}
+	encrypted, err := d.EncryptDataTo(string(data), []string{recipient})
+	if err != nil {
+		return err
+	}
+	return d.Filehandler.WriteFile(path, encrypted)
+}
+
+func fetchOAuth2Token(ctx context.Context, config *OAuth2Config) (*oauth2Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(config.Scopes) > 0 {
+		form.Set("scope", strings.Join(config.Scopes, " "))
+	}
+	if config.Audience != "" {
+		form.Set("audience", config.Audience)
+	}
+	if config.AuthStyle != "basic" {
+		form.Set("client_id", config.ClientID)
+		form.Set("client_secret", config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if config.AuthStyle == "basic" {
+		req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(config.ClientSecret))
+	}
+
+	issuedAt := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	var result oauth2Response
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("invalid token response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("token request failed: %s %s", result.Error, result.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed: HTTP %d", resp.StatusCode)
+	}
+	if result.AccessToken == "" {
+		return nil, errors.New("token response has no access_token")
+	}
+
+	token := &oauth2Token{AccessToken: result.AccessToken}
+	if result.ExpiresIn > 0 {
+		token.ExpiresAt = issuedAt.Add(time.Duration(result.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
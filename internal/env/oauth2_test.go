@@ -0,0 +1,119 @@
+package env
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tokenServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchOAuth2TokenForm(t *testing.T) {
+	server := tokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method %s", r.Method)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		want := url.Values{
+			"grant_type":    {"client_credentials"},
+			"scope":         {"read write"},
+			"audience":      {"https://api.example.com"},
+			"client_id":     {"my-client"},
+			"client_secret": {"s3cret"},
+		}
+		for name, values := range want {
+			if r.PostForm.Get(name) != values[0] {
+				t.Errorf("%s = %q, want %q", name, r.PostForm.Get(name), values[0])
+			}
+		}
+		if _, _, ok := r.BasicAuth(); ok {
+			t.Error("credentials sent in the header and the form")
+		}
+		w.Write([]byte(`{"access_token": "token-1", "token_type": "Bearer", "expires_in": 3600}`))
+	})
+
+	config := &OAuth2Config{
+		TokenURL:     server.URL,
+		ClientID:     "my-client",
+		ClientSecret: "s3cret",
+		Scopes:       []string{"read", "write"},
+		Audience:     "https://api.example.com",
+	}
+	before := time.Now()
+	token, err := fetchOAuth2Token(context.Background(), config)
+	after := time.Now()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "token-1" {
+		t.Errorf("access token %q", token.AccessToken)
+	}
+	if token.ExpiresAt.Before(before.Add(time.Hour)) || token.ExpiresAt.After(after.Add(time.Hour)) {
+		t.Errorf("expires at %v, want an hour after %v", token.ExpiresAt, before)
+	}
+}
+
+func TestFetchOAuth2TokenBasicAuth(t *testing.T) {
+	server := tokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		// RFC 6749 section 2.3.1 encodes the credentials before the header
+		if !ok || user != "my+client" || password != "p%40ss" {
+			t.Errorf("basic auth %q %q %v", user, password, ok)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if r.PostForm.Has("client_id") || r.PostForm.Has("client_secret") {
+			t.Errorf("credentials in the form: %v", r.PostForm)
+		}
+		w.Write([]byte(`{"access_token": "token-2"}`))
+	})
+
+	config := &OAuth2Config{TokenURL: server.URL, ClientID: "my client", ClientSecret: "p@ss", AuthStyle: "basic"}
+	token, err := fetchOAuth2Token(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "token-2" {
+		t.Errorf("access token %q", token.AccessToken)
+	}
+	// Tokens without expires_in are not cached
+	if !token.ExpiresAt.IsZero() {
+		t.Errorf("expires at %v, want zero", token.ExpiresAt)
+	}
+}
+
+func TestFetchOAuth2TokenErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		err    string
+	}{
+		{"error response", http.StatusUnauthorized, `{"error": "invalid_client", "error_description": "unknown client"}`, "invalid_client unknown client"},
+		{"non-200", http.StatusInternalServerError, `{}`, "HTTP 500"},
+		{"not JSON", http.StatusBadGateway, `<html>`, "invalid token response (HTTP 502)"},
+		{"missing access_token", http.StatusOK, `{"token_type": "Bearer"}`, "no access_token"},
+	}
+	for _, test := range tests {
+		server := tokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			w.Write([]byte(test.body))
+		})
+		_, err := fetchOAuth2Token(context.Background(), &OAuth2Config{TokenURL: server.URL, ClientID: "my-client"})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got %v, want %q", test.name, err, test.err)
+		}
+	}
+}
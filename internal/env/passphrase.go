@@ -0,0 +1,45 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+
+	"denv/internal/agefile"
+)
+
+/*
+ * Keys with `passphrase: true` in their metadata are encrypted with a
+ * passphrase (scrypt) instead of the recipients, e.g. for break-glass
+ * secrets. age asks for the passphrase on the terminal.
+ *
+ * They are skipped when all keys are decrypted, e.g. by reindex and
+ * reencryptAll, so that nobody is asked for passphrases in bulk.
+ */
+
+func IsPassphraseProtected(encrypted string) bool {
+	header, err := agefile.ParseHeader([]byte(encrypted))
+	if err != nil {
+		return false
+	}
+	for _, stanza := range header.Stanzas {
+		if stanza.Type == "scrypt" {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *DynamicEnv) EncryptWithPassphrase(data string) (string, error) {
+	cmd := exec.Command("age", "-a", "-p")
+	cmd.Stdin = strings.NewReader(data)
+	cmd.Stderr = os.Stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", errors.New("failed to encrypt data: " + err.Error())
+	}
+
+	return string(output), nil
+}
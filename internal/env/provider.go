@@ -0,0 +1,163 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"denv/internal/prompt"
+	"denv/internal/runner"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * Value providers are custom YAML tags in the `env` and `local` sections that
+ * are resolved when an env is loaded:
+ *
+ * ```
+ * local:
+ *   token: !cmd "gh auth token"
+ * env:
+ *   GITHUB_TOKEN: ${token}
+ *   CERT: !file ~/certs/dev.pem
+ *   EDITOR: !env EDITOR
+ *   OTP: !prompt "OTP code: "
+ * ```
+ *
+ * Providers are disabled unless listed in `providers.allow` of config.yml.
+ */
+
+const defaultProviderTimeout = 30 * time.Second
+
+type valueProvider func(ctx context.Context, arg string) (string, error)
+
+var valueProviders = map[string]valueProvider{
+	"file":   provideFile,
+	"cmd":    provideCmd,
+	"env":    provideEnv,
+	"prompt": providePrompt,
+}
+
+func providerName(tag string) (string, bool) {
+	if !strings.HasPrefix(tag, "!") || strings.HasPrefix(tag, "!!") {
+		return "", false
+	}
+	name := strings.TrimPrefix(tag, "!")
+	_, ok := valueProviders[name]
+	return name, ok
+}
+
+func (d *DynamicEnv) providerTimeout() time.Duration {
+	if seconds := d.UserConfig.Data.Providers.Timeout; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultProviderTimeout
+}
+
+func (d *DynamicEnv) resolveNode(node *yaml.Node) (string, error) {
+	name, ok := providerName(node.Tag)
+	if !ok {
+		var value any
+		if err := node.Decode(&value); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v", value), nil
+	}
+
+	if node.Kind != yaml.ScalarNode {
+		return "", fmt.Errorf("provider !%s expects a scalar value", name)
+	}
+	if !d.UserConfig.IsProviderAllowed(name) {
+		return "", fmt.Errorf("provider !%s is not allowed, add it to providers.allow in %s", name, d.Config.ConfigFile)
+	}
+
+	cacheKey := name + "\x00" + node.Value
+	if value, ok := d.providerCache[cacheKey]; ok {
+		return value, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.providerTimeout())
+	defer cancel()
+
+	value, err := valueProviders[name](ctx, node.Value)
+	if err != nil {
+		return "", fmt.Errorf("provider !%s failed: %w", name, err)
+	}
+	if d.providerCache == nil {
+		d.providerCache = make(map[string]string)
+	}
+	d.providerCache[cacheKey] = value
+	return value, nil
+}
+
+func withTimeout(ctx context.Context, fn func() (string, error)) (string, error) {
+	type result struct {
+		value string
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn()
+		done <- result{value, err}
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return "", errors.New("timed out")
+	}
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(os.Getenv("HOME"), path[1:])
+	}
+	return path
+}
+
+func provideFile(ctx context.Context, arg string) (string, error) {
+	return withTimeout(ctx, func() (string, error) {
+		data, err := os.ReadFile(expandHome(arg))
+		return string(data), err
+	})
+}
+
+func provideCmd(ctx context.Context, arg string) (string, error) {
+	args := runner.ShellArgs(arg)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	// The context kills the command, don't wait for grandchildren holding
+	// its stdout after a timeout
+	return withTimeout(ctx, func() (string, error) {
+		output, err := cmd.Output()
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", errors.New("timed out")
+			}
+			return "", err
+		}
+		return strings.TrimRight(string(output), "\r\n"), nil
+	})
+}
+
+func provideEnv(ctx context.Context, arg string) (string, error) {
+	value, ok := os.LookupEnv(arg)
+	if !ok {
+		return "", fmt.Errorf("$%s is not set", arg)
+	}
+	return value, nil
+}
+
+func providePrompt(ctx context.Context, arg string) (string, error) {
+	timeout := time.Duration(0)
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	return prompt.Secret(arg, timeout)
+}
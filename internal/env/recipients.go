@@ -0,0 +1,100 @@
+package env
+
+import (
+	"fmt"
+	"sort"
+
+	"denv/internal/agefile"
+)
+
+const (
+	AccessNone     = "none"
+	AccessPossible = "possible"
+	AccessReadable = "readable"
+)
+
+// RecipientAccess tells from the stanzas in the header of the file of a key
+// whether a recipient can decrypt it. SSH stanzas carry a tag of their
+// recipient. X25519 and plugin stanzas don't, so a file with stanzas of the
+// recipient's type is readable when the recipient is configured for the key
+// and possibly readable otherwise, e.g. when the rules changed since it was
+// encrypted.
+func (d *DynamicEnv) RecipientAccess(key string, recipient string) (string, error) {
+	inspection, err := d.InspectEnv(key)
+	if err != nil {
+		return AccessNone, err
+	}
+	if inspection.Err != nil {
+		return AccessNone, fmt.Errorf("%s: %w", key, inspection.Err)
+	}
+	if inspection.Passphrase {
+		return AccessNone, nil
+	}
+	if isSSHRecipient(recipient) {
+		tag, err := agefile.SSHTag(recipient)
+		if err != nil {
+			return AccessNone, err
+		}
+		for _, stanza := range inspection.Stanzas {
+			if stanza.Tag() == tag {
+				return AccessReadable, nil
+			}
+		}
+		return AccessNone, nil
+	}
+
+	x25519 := isX25519Recipient(recipient)
+	found := false
+	for _, stanza := range inspection.Stanzas {
+		if (stanza.Type == "X25519") == x25519 && stanza.Tag() == "" {
+			found = true
+		}
+	}
+	if !found {
+		return AccessNone, nil
+	}
+	for _, expected := range inspection.Expected {
+		if expected == recipient {
+			return AccessReadable, nil
+		}
+	}
+	return AccessPossible, nil
+}
+
+// Reencrypt saves values again so that they are encrypted to the current
+// recipients.
+func (d *DynamicEnv) Reencrypt(values []*DynamicEnvValue) error {
+	failed := 0
+	for _, value := range values {
+		if err := d.SetEnv(value.Metadata.ID, value); err != nil {
+			fmt.Println("Failed to reencrypt:", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to reencrypt %d of %d keys", failed, len(values))
+	}
+	return nil
+}
+
+// VariableNames lists what a value holds as section.name, e.g. to report
+// which credentials have to be rotated.
+func VariableNames(value *DynamicEnvValue) []string {
+	var names []string
+	for _, section := range []string{"env", "local", "files", "oauth2"} {
+		values, ok := value.Data[section].(map[string]any)
+		if !ok {
+			continue
+		}
+		sectionNames := make([]string, 0, len(values))
+		for name := range values {
+			sectionNames = append(sectionNames, section+"."+name)
+		}
+		sort.Strings(sectionNames)
+		names = append(names, sectionNames...)
+	}
+	if value.Payload != "" {
+		names = append(names, "payload")
+	}
+	return names
+}
@@ -0,0 +1,368 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"denv/internal/config"
+	"denv/internal/secretgen"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * Rotating the identity in the identities file runs in steps, and the step
+ * reached is saved next to the identities file so that an interrupted
+ * rotation continues where it stopped:
+ *
+ * 1. generated:   the new identity is written to `<identities>.new`
+ * 2. added:       its recipient is added with the groups of the old one
+ * 3. reencrypted: all keys are encrypted to both recipients
+ * 4. verified:    all files decrypt with the new identity alone
+ * 5. installed:   the old identity is archived and replaced by the new one
+ *
+ * Finally the old recipient is removed and the keys are encrypted again.
+ */
+
+const (
+	RotationGenerated   = "generated"
+	RotationAdded       = "added"
+	RotationReencrypted = "reencrypted"
+	RotationVerified    = "verified"
+	RotationInstalled   = "installed"
+	RotationDone        = "done"
+)
+
+type Rotation struct {
+	Step         string    `yaml:"step"`
+	OldRecipient string    `yaml:"old_recipient"`
+	NewRecipient string    `yaml:"new_recipient"`
+	Started      time.Time `yaml:"started"`
+	Archive      string    `yaml:"archive,omitempty"`
+}
+
+func (d *DynamicEnv) rotationFile() string {
+	return d.Config.Identities + ".rotation.yml"
+}
+
+func (d *DynamicEnv) newIdentityFile() string {
+	return d.Config.Identities + ".new"
+}
+
+func writeNewFile(file string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadRotation returns the rotation in progress, or nil.
+func (d *DynamicEnv) LoadRotation() (*Rotation, error) {
+	data, err := os.ReadFile(d.rotationFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rotation Rotation
+	if err := yaml.Unmarshal(data, &rotation); err != nil {
+		return nil, fmt.Errorf("invalid rotation state in %s: %w", d.rotationFile(), err)
+	}
+	return &rotation, nil
+}
+
+func (d *DynamicEnv) saveRotation(rotation *Rotation) error {
+	data, err := yaml.Marshal(rotation)
+	if err != nil {
+		return err
+	}
+	file := d.rotationFile()
+	if err := os.WriteFile(file+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to save rotation state: %w", err)
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// StartRotation generates the new identity.
+func (d *DynamicEnv) StartRotation() (*Rotation, error) {
+	if d.Config.IdentityData != "" {
+		return nil, errors.New("identities in DENV_IDENTITY can't be rotated, unset it to rotate the identities file")
+	}
+	recipients, err := identityRecipients(d.Config.Identities)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity: %w", err)
+	}
+	if len(recipients) != 1 {
+		return nil, fmt.Errorf("%s contains %d identities, only files with one identity can be rotated", d.Config.Identities, len(recipients))
+	}
+	if d.UserConfig.FindRecipient(recipients[0]) == nil {
+		return nil, fmt.Errorf("the recipient of %s is not in config.yml: %s", d.Config.Identities, recipients[0])
+	}
+
+	identity, recipient, err := secretgen.AgeIdentity()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeNewFile(d.newIdentityFile(), []byte(identity+"\n")); err != nil {
+		return nil, fmt.Errorf("failed to write new identity: %w", err)
+	}
+	rotation := &Rotation{
+		Step:         RotationGenerated,
+		OldRecipient: recipients[0],
+		NewRecipient: recipient,
+		Started:      time.Now().UTC().Truncate(time.Second),
+	}
+	return rotation, d.saveRotation(rotation)
+}
+
+// addToRules adds the new key to rules that refer to the old recipient by
+// key or name. Groups are copied to the new recipient instead.
+func (d *DynamicEnv) addToRules(oldKey string, newKey string) {
+	for i, rule := range d.UserConfig.Data.Rules {
+		refersToOld, hasNew := false, false
+		for _, reference := range rule.Recipients {
+			if recipient := d.UserConfig.FindRecipient(reference); recipient != nil && recipient.Key == oldKey {
+				refersToOld = true
+			}
+			hasNew = hasNew || reference == newKey
+		}
+		if refersToOld && !hasNew {
+			d.UserConfig.Data.Rules[i].Recipients = append(rule.Recipients, newKey)
+		}
+	}
+}
+
+// removeFromRules removes the old key from rules. Rules that refer to the
+// recipient by name keep the name, which moves to the new recipient.
+func (d *DynamicEnv) removeFromRules(oldKey string, newKey string, name string) {
+	for i, rule := range d.UserConfig.Data.Rules {
+		byName := false
+		for _, reference := range rule.Recipients {
+			byName = byName || (name != "" && reference == name)
+		}
+		references := []string{}
+		for _, reference := range rule.Recipients {
+			if config.NormalizeRecipientKey(reference) == oldKey || (byName && reference == newKey) {
+				continue
+			}
+			references = append(references, reference)
+		}
+		d.UserConfig.Data.Rules[i].Recipients = references
+	}
+}
+
+func (d *DynamicEnv) addRotatedRecipient(rotation *Rotation) error {
+	if d.UserConfig.FindRecipient(rotation.NewRecipient) == nil {
+		recipient := config.Recipient{Key: rotation.NewRecipient}
+		if old := d.UserConfig.FindRecipient(rotation.OldRecipient); old != nil {
+			// The name moves to the new recipient when the old one is removed
+			recipient.Email, recipient.Comment = old.Email, old.Comment
+			recipient.Groups = append([]string{}, old.Groups...)
+		}
+		d.UserConfig.Data.Recipients = append(d.UserConfig.Data.Recipients, recipient)
+	}
+	d.addToRules(rotation.OldRecipient, rotation.NewRecipient)
+	return d.UserConfig.SaveUserConfig()
+}
+
+// VerifyDecryptsWith decrypts all files that the previous identity files can
+// decrypt with the given identity files only, and returns the files that
+// fail. Files the previous identities can't read, e.g. because of rules, are
+// not checked.
+func (d *DynamicEnv) VerifyDecryptsWith(identityFiles []string, previous []string) (int, []string, error) {
+	files, err := d.ListEnvFiles("")
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	checked := 0
+	var failed []string
+	for _, file := range files {
+		if !strings.HasSuffix(file, d.Config.EnvSuffix) {
+			continue
+		}
+		data, err := d.Filehandler.ReadFile(filepath.Join(d.Config.DataDir, file))
+		if err != nil {
+			return 0, nil, err
+		}
+		if IsPassphraseProtected(data) {
+			continue
+		}
+		if _, err := decryptWith(data, previous); err != nil {
+			continue
+		}
+		checked++
+		if _, err := decryptWith(data, identityFiles); err != nil {
+			failed = append(failed, file)
+		}
+	}
+	return checked, failed, nil
+}
+
+func copyFile(source string, target string) error {
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	return writeNewFile(target, data)
+}
+
+func (d *DynamicEnv) installRotatedIdentity(rotation *Rotation) error {
+	// Interrupted after the new identity was moved in place
+	if _, err := os.Stat(d.newIdentityFile()); errors.Is(err, os.ErrNotExist) {
+		recipients, err := identityRecipients(d.Config.Identities)
+		if err == nil && len(recipients) == 1 && recipients[0] == rotation.NewRecipient {
+			return nil
+		}
+		return fmt.Errorf("new identity %s is missing", d.newIdentityFile())
+	}
+
+	if rotation.Archive == "" {
+		rotation.Archive = filepath.Join(filepath.Dir(d.Config.Identities), "archive",
+			filepath.Base(d.Config.Identities)+"-"+time.Now().UTC().Format("20060102-150405"))
+		if err := d.saveRotation(rotation); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(rotation.Archive); errors.Is(err, os.ErrNotExist) {
+		if err := copyFile(d.Config.Identities, rotation.Archive); err != nil {
+			return fmt.Errorf("failed to archive old identity: %w", err)
+		}
+	}
+	if err := os.Rename(d.newIdentityFile(), d.Config.Identities); err != nil {
+		return fmt.Errorf("failed to install new identity: %w", err)
+	}
+	d.UseIdentityFile()
+	return nil
+}
+
+func (d *DynamicEnv) removeRotatedRecipient(rotation *Rotation) error {
+	var name string
+	if old := d.UserConfig.FindRecipient(rotation.OldRecipient); old != nil {
+		name = old.Name
+	}
+	recipients := []config.Recipient{}
+	for _, recipient := range d.UserConfig.Data.Recipients {
+		if recipient.Key == rotation.OldRecipient {
+			continue
+		}
+		if recipient.Key == rotation.NewRecipient && name != "" {
+			recipient.Name = name
+		}
+		recipients = append(recipients, recipient)
+	}
+	d.removeFromRules(rotation.OldRecipient, rotation.NewRecipient, name)
+	d.UserConfig.Data.Recipients = recipients
+	if err := d.UserConfig.CheckRules(); err != nil {
+		d.UserConfig.LoadUserConfig()
+		return err
+	}
+	// config.yml keeps the old recipient until all keys are encrypted without
+	// it, so that the step is repeated when it fails
+	if _, err := d.ReencryptAll(); err != nil {
+		d.UserConfig.LoadUserConfig()
+		return err
+	}
+	return d.UserConfig.SaveUserConfig()
+}
+
+// ContinueRotation runs the next step of a rotation and saves the
+// checkpoint. It returns a description of the step.
+func (d *DynamicEnv) ContinueRotation(rotation *Rotation) (string, error) {
+	var message string
+	next := ""
+	switch rotation.Step {
+	case RotationGenerated:
+		if err := d.addRotatedRecipient(rotation); err != nil {
+			return "", fmt.Errorf("failed to add new recipient: %w", err)
+		}
+		message, next = "Added the new recipient to config.yml", RotationAdded
+	case RotationAdded:
+		skipped, err := d.ReencryptAll()
+		if err != nil {
+			return "", err
+		}
+		message, next = "Encrypted all keys to the old and the new recipient", RotationReencrypted
+		if len(skipped) > 0 {
+			message += fmt.Sprintf(", skipped %d files this identity can't read", len(skipped))
+		}
+	case RotationReencrypted:
+		checked, failed, err := d.VerifyDecryptsWith([]string{d.newIdentityFile()}, []string{d.Config.Identities})
+		if err != nil {
+			return "", fmt.Errorf("failed to verify: %w", err)
+		}
+		if len(failed) > 0 {
+			return "", fmt.Errorf("%d of %d files don't decrypt with the new identity: %s", len(failed), checked, strings.Join(failed, ", "))
+		}
+		message, next = fmt.Sprintf("Verified that %d files decrypt with the new identity", checked), RotationVerified
+	case RotationVerified:
+		if err := d.installRotatedIdentity(rotation); err != nil {
+			return "", err
+		}
+		message, next = "Archived the old identity in "+rotation.Archive, RotationInstalled
+	case RotationInstalled:
+		if err := d.removeRotatedRecipient(rotation); err != nil {
+			return "", err
+		}
+		if err := os.Remove(d.rotationFile()); err != nil {
+			return "", err
+		}
+		rotation.Step = RotationDone
+		return "Removed the old recipient and encrypted all keys to the new one", nil
+	default:
+		return "", fmt.Errorf("unknown rotation step: %s", rotation.Step)
+	}
+	rotation.Step = next
+	return message, d.saveRotation(rotation)
+}
+
+// AbortRotation removes the new recipient and identity, as long as the new
+// identity is not installed yet.
+func (d *DynamicEnv) AbortRotation(rotation *Rotation) error {
+	if rotation.Step == RotationInstalled {
+		return errors.New("the new identity is already installed, finish the rotation instead")
+	}
+	if rotation.Step != RotationGenerated {
+		recipients := []config.Recipient{}
+		for _, recipient := range d.UserConfig.Data.Recipients {
+			if recipient.Key != rotation.NewRecipient {
+				recipients = append(recipients, recipient)
+			}
+		}
+		d.UserConfig.Data.Recipients = recipients
+		for i, rule := range d.UserConfig.Data.Rules {
+			var references []string
+			for _, reference := range rule.Recipients {
+				if reference != rotation.NewRecipient {
+					references = append(references, reference)
+				}
+			}
+			d.UserConfig.Data.Rules[i].Recipients = references
+		}
+		if err := d.UserConfig.SaveUserConfig(); err != nil {
+			return err
+		}
+		if _, err := d.ReencryptAll(); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(d.newIdentityFile()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.Remove(d.rotationFile())
+}
@@ -0,0 +1,37 @@
+package env
+
+import (
+	"fmt"
+	"time"
+
+	"denv/internal/totp"
+)
+
+/*
+ * The current TOTP code of a seed kept in a local variable is available as
+ * `${totp:NAME}`:
+ *
+ * ```
+ * local:
+ *   SEED: otpauth://totp/ci?secret=JBSWY3DPEHPK3PXP
+ * env:
+ *   OTP: ${totp:SEED}
+ * ```
+ */
+
+const totpPrefix = "totp:"
+
+func totpCode(name string, parsed *DynamicEnvParsed) (string, error) {
+	seed, ok := parsed.Local[name]
+	if !ok {
+		seed, ok = parsed.Env[name]
+	}
+	if !ok {
+		return "", fmt.Errorf("TOTP seed not found: %s", name)
+	}
+	config, err := totp.Parse(seed)
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP seed in %s: %w", name, err)
+	}
+	return config.Code(time.Now())
+}
@@ -0,0 +1,85 @@
+package prompt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+func openTTY() (*os.File, func()) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return os.Stdin, func() {}
+	}
+	return tty, func() { tty.Close() }
+}
+
+func readLine(input *os.File, timeout time.Duration) (string, error) {
+	result := make(chan string, 1)
+	failed := make(chan error, 1)
+	go func() {
+		line, err := bufio.NewReader(input).ReadString('\n')
+		if err != nil && line == "" {
+			failed <- err
+			return
+		}
+		result <- strings.TrimRight(line, "\r\n")
+	}()
+
+	var timer <-chan time.Time
+	if timeout > 0 {
+		timer = time.After(timeout)
+	}
+	select {
+	case line := <-result:
+		return line, nil
+	case err := <-failed:
+		return "", err
+	case <-timer:
+		return "", errors.New("timed out waiting for input")
+	}
+}
+
+func setEcho(input *os.File, enabled bool) {
+	mode := "-echo"
+	if enabled {
+		mode = "echo"
+	}
+	cmd := exec.Command("stty", mode)
+	cmd.Stdin = input
+	cmd.Run()
+}
+
+// Line asks for a line of input, preferring the controlling terminal over stdin.
+func Line(message string, timeout time.Duration) (string, error) {
+	input, done := openTTY()
+	defer done()
+	fmt.Fprint(os.Stderr, message)
+	return readLine(input, timeout)
+}
+
+// Secret asks for a line of input without echoing it back.
+func Secret(message string, timeout time.Duration) (string, error) {
+	input, done := openTTY()
+	defer done()
+	fmt.Fprint(os.Stderr, message)
+	setEcho(input, false)
+	defer func() {
+		setEcho(input, true)
+		fmt.Fprintln(os.Stderr)
+	}()
+	return readLine(input, timeout)
+}
+
+func Confirm(message string) bool {
+	answer, err := Line(message+" [y/N] ", 0)
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
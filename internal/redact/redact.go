@@ -0,0 +1,113 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// Values shorter than this are too likely to appear by accident
+const minSecretLength = 4
+
+type pattern struct {
+	value       []byte
+	replacement []byte
+}
+
+// Redactor replaces secret values in a stream, holding back partial matches
+// at the end of a chunk until the next write tells whether they match.
+type Redactor struct {
+	mu       sync.Mutex
+	w        io.Writer
+	patterns []pattern
+	pending  []byte
+}
+
+func encodings(value string) []string {
+	return []string{
+		value,
+		base64.StdEncoding.EncodeToString([]byte(value)),
+		base64.RawStdEncoding.EncodeToString([]byte(value)),
+		base64.URLEncoding.EncodeToString([]byte(value)),
+		base64.RawURLEncoding.EncodeToString([]byte(value)),
+		url.QueryEscape(value),
+		url.PathEscape(value),
+	}
+}
+
+func New(w io.Writer, secrets map[string]string) *Redactor {
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	seen := make(map[string]bool)
+	var patterns []pattern
+	for _, name := range names {
+		if len(secrets[name]) < minSecretLength {
+			continue
+		}
+		for _, value := range encodings(secrets[name]) {
+			if seen[value] {
+				continue
+			}
+			seen[value] = true
+			patterns = append(patterns, pattern{
+				value:       []byte(value),
+				replacement: []byte("***" + name + "***"),
+			})
+		}
+	}
+	// Prefer the longest match at each position
+	sort.SliceStable(patterns, func(i, j int) bool {
+		return len(patterns[i].value) > len(patterns[j].value)
+	})
+	return &Redactor{w: w, patterns: patterns}
+}
+
+func (r *Redactor) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	buf := append(r.pending, p...)
+	var out bytes.Buffer
+	i := 0
+scan:
+	for i < len(buf) {
+		for _, pat := range r.patterns {
+			if bytes.HasPrefix(buf[i:], pat.value) {
+				out.Write(pat.replacement)
+				i += len(pat.value)
+				continue scan
+			}
+			if bytes.HasPrefix(pat.value, buf[i:]) {
+				// Possibly split across writes, wait for more data
+				break scan
+			}
+		}
+		out.WriteByte(buf[i])
+		i++
+	}
+	r.pending = append([]byte{}, buf[i:]...)
+
+	if _, err := r.w.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes out data held back for a possible match.
+func (r *Redactor) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) == 0 {
+		return nil
+	}
+	_, err := r.w.Write(r.pending)
+	r.pending = nil
+	return err
+}
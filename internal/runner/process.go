@@ -0,0 +1,71 @@
+package runner
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+)
+
+type Process struct {
+	Cmd  *exec.Cmd
+	done chan struct{}
+	err  error
+}
+
+func Start(cmd *exec.Cmd) (*Process, error) {
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p := &Process{Cmd: cmd, done: make(chan struct{})}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			p.err = exitCode(err)
+		}
+		close(p.done)
+	}()
+	return p, nil
+}
+
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// Err returns the exit error once the process is done.
+func (p *Process) Err() error {
+	<-p.done
+	return p.err
+}
+
+func (p *Process) Signal(sig os.Signal) {
+	select {
+	case <-p.done:
+	default:
+		p.Cmd.Process.Signal(sig)
+	}
+}
+
+// Stop sends sig to the process and kills it if it is still running after grace.
+func (p *Process) Stop(sig os.Signal, grace time.Duration) error {
+	p.Signal(sig)
+	select {
+	case <-p.done:
+	case <-time.After(grace):
+		p.Cmd.Process.Kill()
+		<-p.done
+	}
+	return p.err
+}
+
+func NotifySignals(c chan<- os.Signal) {
+	signal.Notify(c, forwardedSignals...)
+}
+
+func IsTermination(sig os.Signal) bool {
+	for _, s := range terminationSignals {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
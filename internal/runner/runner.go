@@ -0,0 +1,69 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"syscall"
+)
+
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func exitCode(err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		// Follow the shell convention for children killed by a signal
+		return &ExitError{Code: 128 + int(status.Signal())}
+	}
+	return &ExitError{Code: exitErr.ExitCode()}
+}
+
+func ShellArgs(command string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", command}
+	}
+	return []string{"sh", "-c", command}
+}
+
+func Command(args []string, env []string) *exec.Cmd {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// Run forwards signals received by denv to the command until it exits, and
+// reports a non-zero exit as *ExitError.
+func Run(cmd *exec.Cmd) error {
+	p, err := Start(cmd)
+	if err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	NotifySignals(signals)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case sig := <-signals:
+			p.Signal(sig)
+		case <-p.Done():
+			return p.Err()
+		}
+	}
+}
@@ -0,0 +1,63 @@
+//go:build !windows
+
+package runner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+var forwardedSignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGTERM,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+	syscall.SIGWINCH,
+}
+
+var terminationSignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGTERM,
+	syscall.SIGHUP,
+}
+
+func ParseSignal(name string) (os.Signal, error) {
+	name = strings.TrimPrefix(strings.ToUpper(name), "SIG")
+	signals := map[string]os.Signal{
+		"INT":  syscall.SIGINT,
+		"TERM": syscall.SIGTERM,
+		"HUP":  syscall.SIGHUP,
+		"QUIT": syscall.SIGQUIT,
+		"KILL": syscall.SIGKILL,
+		"USR1": syscall.SIGUSR1,
+		"USR2": syscall.SIGUSR2,
+	}
+	sig, ok := signals[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signal: %s", name)
+	}
+	return sig, nil
+}
+
+// SignalError reports a termination by a signal with the shell convention.
+func SignalError(sig os.Signal) error {
+	if s, ok := sig.(syscall.Signal); ok {
+		return &ExitError{Code: 128 + int(s)}
+	}
+	return &ExitError{Code: 1}
+}
+
+// Exec replaces the current process with the command so that it receives
+// signals and reports its exit code directly.
+func Exec(args []string, env []string) error {
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, args, env)
+}
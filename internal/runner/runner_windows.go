@@ -0,0 +1,38 @@
+//go:build windows
+
+package runner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+var forwardedSignals = []os.Signal{
+	os.Interrupt,
+}
+
+var terminationSignals = []os.Signal{
+	os.Interrupt,
+}
+
+// ParseSignal only supports interrupting or killing processes on Windows.
+func ParseSignal(name string) (os.Signal, error) {
+	switch strings.TrimPrefix(strings.ToUpper(name), "SIG") {
+	case "INT", "TERM":
+		return os.Interrupt, nil
+	case "KILL":
+		return os.Kill, nil
+	}
+	return nil, fmt.Errorf("unsupported signal: %s", name)
+}
+
+// SignalError reports a termination by a signal, Windows has no signal codes.
+func SignalError(sig os.Signal) error {
+	return &ExitError{Code: 1}
+}
+
+// Exec falls back to running the command as a child since Windows has no exec.
+func Exec(args []string, env []string) error {
+	return Run(Command(args, env))
+}
@@ -0,0 +1,173 @@
+package secretgen
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	_ "embed"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os/exec"
+	"strings"
+)
+
+// The BIP39 English word list, 2048 words give 11 bits of entropy per word.
+//
+//go:embed words.txt
+var wordList string
+
+var Charsets = map[string]string{
+	"alnum":   "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	"alpha":   "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+	"lower":   "abcdefghijklmnopqrstuvwxyz",
+	"digits":  "0123456789",
+	"hex":     "0123456789abcdef",
+	"symbols": "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!#$%&()*+,-./:;<=>?@[]^_{|}~",
+}
+
+func randomIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
+
+func Password(length int, charset string) (string, error) {
+	if length <= 0 {
+		return "", errors.New("length must be positive")
+	}
+	chars := []rune(charset)
+	if len(chars) < 2 {
+		return "", errors.New("charset must contain at least 2 characters")
+	}
+	result := make([]rune, length)
+	for i := range result {
+		j, err := randomIndex(len(chars))
+		if err != nil {
+			return "", err
+		}
+		result[i] = chars[j]
+	}
+	return string(result), nil
+}
+
+func Passphrase(count int, separator string) (string, error) {
+	if count <= 0 {
+		return "", errors.New("number of words must be positive")
+	}
+	words := strings.Fields(wordList)
+	result := make([]string, count)
+	for i := range result {
+		j, err := randomIndex(len(words))
+		if err != nil {
+			return "", err
+		}
+		result[i] = words[j]
+	}
+	return strings.Join(result, separator), nil
+}
+
+func Bytes(size int) ([]byte, error) {
+	if size <= 0 {
+		return nil, errors.New("size must be positive")
+	}
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	return data, err
+}
+
+func Hex(size int) (string, error) {
+	data, err := Bytes(size)
+	return hex.EncodeToString(data), err
+}
+
+func Base64(size int) (string, error) {
+	data, err := Bytes(size)
+	return base64.StdEncoding.EncodeToString(data), err
+}
+
+func UUID() (string, error) {
+	data, err := Bytes(16)
+	if err != nil {
+		return "", err
+	}
+	data[6] = (data[6] & 0x0f) | 0x40
+	data[8] = (data[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", data[0:4], data[4:6], data[6:8], data[8:10], data[10:]), nil
+}
+
+func sshString(buf *bytes.Buffer, data []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+}
+
+// SSHEd25519 returns an unencrypted private key in the OpenSSH format and
+// the public key in the authorized_keys format.
+func SSHEd25519(comment string) (string, string, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	var public bytes.Buffer
+	sshString(&public, []byte("ssh-ed25519"))
+	sshString(&public, publicKey)
+
+	check, err := Bytes(4)
+	if err != nil {
+		return "", "", err
+	}
+	var private bytes.Buffer
+	private.Write(check)
+	private.Write(check)
+	sshString(&private, []byte("ssh-ed25519"))
+	sshString(&private, publicKey)
+	sshString(&private, privateKey)
+	sshString(&private, []byte(comment))
+	for i := byte(1); private.Len()%8 != 0; i++ {
+		private.WriteByte(i)
+	}
+
+	var key bytes.Buffer
+	key.WriteString("openssh-key-v1\x00")
+	sshString(&key, []byte("none"))
+	sshString(&key, []byte("none"))
+	sshString(&key, nil)
+	binary.Write(&key, binary.BigEndian, uint32(1))
+	sshString(&key, public.Bytes())
+	sshString(&key, private.Bytes())
+
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: key.Bytes()})
+	authorizedKey := "ssh-ed25519 " + base64.StdEncoding.EncodeToString(public.Bytes())
+	if comment != "" {
+		authorizedKey += " " + comment
+	}
+	return string(privatePEM), authorizedKey, nil
+}
+
+// AgeIdentity generates an identity with age-keygen and returns it with its recipient.
+func AgeIdentity() (string, string, error) {
+	output, err := exec.Command("age-keygen").Output()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to run age-keygen: %w", err)
+	}
+	var identity, recipient string
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "AGE-SECRET-KEY-") {
+			identity = line
+		} else if strings.HasPrefix(line, "# public key: ") {
+			recipient = strings.TrimPrefix(line, "# public key: ")
+		}
+	}
+	if identity == "" || recipient == "" {
+		return "", "", errors.New("unexpected output from age-keygen")
+	}
+	return identity, recipient, nil
+}
@@ -0,0 +1,137 @@
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+/*
+ * Shamir's secret sharing over GF(256): every byte of the secret is the
+ * constant term of a random polynomial of degree threshold-1, and a share
+ * is the value of all polynomials at its x coordinate. Any threshold shares
+ * determine the polynomials, fewer reveal nothing about the secret.
+ */
+
+var expTable [510]byte
+var logTable [256]byte
+
+func init() {
+	// 3 generates the multiplicative group of GF(256) with the AES polynomial
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i] = x
+		expTable[i+255] = x
+		logTable[x] = byte(i)
+		x ^= multiplyNoTable(x, 2)
+	}
+}
+
+func multiplyNoTable(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 == 1 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+func multiply(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+func divide(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+255-int(logTable[b])]
+}
+
+type Share struct {
+	X     byte
+	Value []byte
+}
+
+// Split splits a secret into n shares, any threshold of them recover it.
+func Split(secret []byte, n int, threshold int) ([]Share, error) {
+	if threshold < 2 {
+		return nil, errors.New("threshold must be at least 2")
+	}
+	if n < threshold || n > 255 {
+		return nil, fmt.Errorf("number of shares must be between the threshold and 255, got %d", n)
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("secret is empty")
+	}
+
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{X: byte(i + 1), Value: make([]byte, len(secret))}
+	}
+	coefficients := make([]byte, threshold)
+	for i, b := range secret {
+		coefficients[0] = b
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		for _, share := range shares {
+			// Horner's method
+			var y byte
+			for j := threshold - 1; j >= 0; j-- {
+				y = multiply(y, share.X) ^ coefficients[j]
+			}
+			share.Value[i] = y
+		}
+	}
+	for i := range coefficients {
+		coefficients[i] = 0
+	}
+	return shares, nil
+}
+
+// Combine recovers the secret from at least threshold shares by Lagrange
+// interpolation at x = 0. With fewer shares the result is garbage.
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least 2 shares are needed")
+	}
+	length := len(shares[0].Value)
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		if share.X == 0 {
+			return nil, errors.New("invalid share with x = 0")
+		}
+		if seen[share.X] {
+			return nil, fmt.Errorf("share %d is given twice", share.X)
+		}
+		seen[share.X] = true
+		if len(share.Value) != length {
+			return nil, errors.New("shares have different lengths")
+		}
+	}
+
+	secret := make([]byte, length)
+	for i, share := range shares {
+		// Lagrange basis polynomial of the share at 0
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = multiply(basis, divide(other.X, other.X^share.X))
+			}
+		}
+		for k, y := range share.Value {
+			secret[k] ^= multiply(basis, y)
+		}
+	}
+	return secret, nil
+}
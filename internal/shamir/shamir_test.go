@@ -0,0 +1,75 @@
+package shamir
+
+import (
+	"bytes"
+	"math/bits"
+	"testing"
+)
+
+func subsets(shares []Share, size int) [][]Share {
+	var result [][]Share
+	for mask := 0; mask < 1<<len(shares); mask++ {
+		if bits.OnesCount(uint(mask)) != size {
+			continue
+		}
+		var subset []Share
+		for i, share := range shares {
+			if mask&(1<<i) != 0 {
+				subset = append(subset, share)
+			}
+		}
+		result = append(result, subset)
+	}
+	return result
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("correct horse battery staple 123")
+	for _, params := range [][2]int{{2, 2}, {3, 2}, {5, 3}, {6, 4}} {
+		n, threshold := params[0], params[1]
+		shares, err := Split(secret, n, threshold)
+		if err != nil {
+			t.Fatalf("split %d of %d: %v", threshold, n, err)
+		}
+		for _, subset := range subsets(shares, threshold) {
+			combined, err := Combine(subset)
+			if err != nil {
+				t.Fatalf("combine %d of %d: %v", threshold, n, err)
+			}
+			if !bytes.Equal(combined, secret) {
+				t.Errorf("combine %d of %d: got %q", threshold, n, combined)
+			}
+		}
+	}
+}
+
+func TestCombineTooFewShares(t *testing.T) {
+	secret := []byte("correct horse battery staple 123")
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, subset := range subsets(shares, 2) {
+		combined, err := Combine(subset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(combined, secret) {
+			t.Errorf("shares %d and %d recovered the secret", subset[0].X, subset[1].X)
+		}
+	}
+}
+
+func TestCombineInvalidShares(t *testing.T) {
+	shares, err := Split([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Combine([]Share{shares[0], shares[0]}); err == nil {
+		t.Error("duplicate shares were accepted")
+	}
+	zero := Share{X: 0, Value: shares[1].Value}
+	if _, err := Combine([]Share{shares[0], zero}); err == nil {
+		t.Error("share with x = 0 was accepted")
+	}
+}
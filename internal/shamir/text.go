@@ -0,0 +1,199 @@
+package shamir
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+/*
+ * Shares are encoded as text that can be printed on paper:
+ *
+ * ```
+ * denv share 2 of 5, 3 needed, set 7F3A09C2
+ * AEAR 6OQJ CEBA GEQD ALKQ VSXG 4N
+ * ...
+ * ```
+ *
+ * The body is base32 of the version, set, threshold, total, x coordinate and
+ * value, followed by a CRC-32. The last word of every line is a checksum of
+ * the line, so that typos can be located when a share is typed in again.
+ */
+
+const textVersion = 1
+const titlePrefix = "denv share"
+const wordLength = 4
+const wordsPerLine = 6
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type TextShare struct {
+	Set       uint32
+	Threshold int
+	Total     int
+	Share
+}
+
+// SplitText splits a secret into shares that belong to a new set.
+func SplitText(secret []byte, n int, threshold int) ([]TextShare, error) {
+	shares, err := Split(secret, n, threshold)
+	if err != nil {
+		return nil, err
+	}
+	var set [4]byte
+	if _, err := rand.Read(set[:]); err != nil {
+		return nil, err
+	}
+	result := make([]TextShare, len(shares))
+	for i, share := range shares {
+		result[i] = TextShare{Set: binary.BigEndian.Uint32(set[:]), Threshold: threshold, Total: n, Share: share}
+	}
+	return result, nil
+}
+
+func lineChecksum(number int, chars string) string {
+	sum := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%d:%s", number, chars))) % 1024
+	return encoding.EncodeToString([]byte{byte(sum >> 2), byte(sum << 6)})[:2]
+}
+
+func (s TextShare) title() string {
+	return fmt.Sprintf("%s %d of %d, %d needed, set %08X", titlePrefix, s.X, s.Total, s.Threshold, s.Set)
+}
+
+func (s TextShare) Encode() string {
+	data := []byte{textVersion, 0, 0, 0, 0, byte(s.Threshold), byte(s.Total), s.X}
+	binary.BigEndian.PutUint32(data[1:5], s.Set)
+	data = append(data, s.Value...)
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(data))
+	data = append(data, checksum...)
+	chars := encoding.EncodeToString(data)
+
+	lines := []string{s.title()}
+	for number := 1; len(chars) > 0; number++ {
+		n := wordLength * wordsPerLine
+		if n > len(chars) {
+			n = len(chars)
+		}
+		line := chars[:n]
+		chars = chars[n:]
+		var words []string
+		for len(line) > 0 {
+			w := wordLength
+			if w > len(line) {
+				w = len(line)
+			}
+			words = append(words, line[:w])
+			line = line[w:]
+		}
+		words = append(words, lineChecksum(number, strings.Join(words, "")))
+		lines = append(lines, strings.Join(words, " "))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// normalize fixes characters that are easily confused on paper, base32
+// has no 0, 1 and 8.
+func normalize(word string) string {
+	return strings.NewReplacer("0", "O", "1", "I", "8", "B").Replace(strings.ToUpper(word))
+}
+
+func decodeBody(lines []string) (*TextShare, error) {
+	var chars strings.Builder
+	for i, line := range lines {
+		words := strings.Fields(line)
+		if len(words) < 2 {
+			return nil, fmt.Errorf("line %d is incomplete", i+1)
+		}
+		for j := range words {
+			words[j] = normalize(words[j])
+		}
+		body := strings.Join(words[:len(words)-1], "")
+		if lineChecksum(i+1, body) != words[len(words)-1] {
+			return nil, fmt.Errorf("line %d has a typo: %s", i+1, line)
+		}
+		chars.WriteString(body)
+	}
+
+	data, err := encoding.DecodeString(chars.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid encoding: %w", err)
+	}
+	if len(data) < 13 {
+		return nil, errors.New("share is too short")
+	}
+	payload, checksum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, errors.New("checksum mismatch, a line is missing or in the wrong order")
+	}
+	if payload[0] != textVersion {
+		return nil, fmt.Errorf("unsupported share version %d", payload[0])
+	}
+	return &TextShare{
+		Set:       binary.BigEndian.Uint32(payload[1:5]),
+		Threshold: int(payload[5]),
+		Total:     int(payload[6]),
+		Share:     Share{X: payload[7], Value: payload[8:]},
+	}, nil
+}
+
+// DecodeText reads all shares in a text, each starting with its title line.
+func DecodeText(text string) ([]TextShare, error) {
+	var shares []TextShare
+	var title string
+	var body []string
+	flush := func() error {
+		if title == "" {
+			return nil
+		}
+		share, err := decodeBody(body)
+		if err != nil {
+			return fmt.Errorf("%s: %w", title, err)
+		}
+		shares = append(shares, *share)
+		return nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(strings.ToLower(line), titlePrefix):
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			title, body = line, nil
+		case line == "":
+		case title == "":
+			return nil, errors.New("share without title line")
+		default:
+			body = append(body, line)
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+// CombineText recovers the secret from shares of the same set.
+func CombineText(shares []TextShare) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares given")
+	}
+	first := shares[0]
+	plain := make([]Share, len(shares))
+	for i, share := range shares {
+		if share.Set != first.Set {
+			return nil, fmt.Errorf("shares belong to different sets: %08X and %08X", first.Set, share.Set)
+		}
+		plain[i] = share.Share
+	}
+	if len(shares) < first.Threshold {
+		return nil, fmt.Errorf("%d shares are needed, got %d", first.Threshold, len(shares))
+	}
+	return Combine(plain)
+}
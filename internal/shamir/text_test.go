@@ -0,0 +1,70 @@
+package shamir
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// A fixed share, so that the line checksums are the same on every run.
+var testShare = TextShare{
+	Set:       0x7F3A09C2,
+	Threshold: 2,
+	Total:     3,
+	Share:     Share{X: 2, Value: []byte("a value long enough to span several lines of words")},
+}
+
+func TestEncodeDecode(t *testing.T) {
+	shares, err := DecodeText(testShare.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 1 {
+		t.Fatalf("got %d shares", len(shares))
+	}
+	share := shares[0]
+	if share.Set != testShare.Set || share.Threshold != testShare.Threshold || share.Total != testShare.Total ||
+		share.X != testShare.X || !bytes.Equal(share.Value, testShare.Value) {
+		t.Errorf("got %+v", share)
+	}
+}
+
+func TestDecodeTypo(t *testing.T) {
+	lines := strings.Split(testShare.Encode(), "\n")
+	if len(lines) < 4 {
+		t.Fatalf("expected several lines, got %q", lines)
+	}
+	// Change the first character of the second line of the body
+	typo := []byte(lines[2])
+	if typo[0] == 'A' {
+		typo[0] = 'C'
+	} else {
+		typo[0] = 'A'
+	}
+	lines[2] = string(typo)
+
+	_, err := DecodeText(strings.Join(lines, "\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2 has a typo") {
+		t.Errorf("got %v, want a typo in line 2", err)
+	}
+}
+
+func TestDecodeNormalizes(t *testing.T) {
+	lines := strings.Split(testShare.Encode(), "\n")
+	replacer := strings.NewReplacer("O", "0", "I", "1", "B", "8")
+	for i := 1; i < len(lines); i++ {
+		lines[i] = strings.ToLower(replacer.Replace(lines[i]))
+	}
+	text := strings.Join(lines, "\n")
+	if !strings.ContainsAny(text, "018") {
+		t.Fatal("share contains no O, I or B to replace")
+	}
+
+	shares, err := DecodeText(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 1 || !bytes.Equal(shares[0].Value, testShare.Value) {
+		t.Errorf("got %+v", shares)
+	}
+}
@@ -0,0 +1,69 @@
+package tmpfs
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+func candidateDirs() []string {
+	var dirs []string
+	if runtime.GOOS == "linux" {
+		dirs = append(dirs, "/dev/shm")
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	return append(dirs, os.TempDir())
+}
+
+// MkdirPrivate creates a directory only accessible by the current user,
+// preferring memory-backed locations so that secrets never hit the disk.
+func MkdirPrivate(pattern string) (string, error) {
+	var lastErr error
+	for _, base := range candidateDirs() {
+		if info, err := os.Stat(base); err != nil || !info.IsDir() {
+			continue
+		}
+		dir, err := os.MkdirTemp(base, pattern)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := os.Chmod(dir, 0700); err != nil {
+			os.RemoveAll(dir)
+			lastErr = err
+			continue
+		}
+		return dir, nil
+	}
+	return "", lastErr
+}
+
+func Shred(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if size := info.Size(); size > 0 {
+		if file, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil {
+			file.Write(make([]byte, size))
+			file.Sync()
+			file.Close()
+		}
+	}
+	return os.Remove(path)
+}
+
+func ShredAll(dir string) error {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			Shred(path)
+		}
+		return nil
+	})
+	return os.RemoveAll(dir)
+}
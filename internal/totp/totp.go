@@ -0,0 +1,137 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ * Time-based one-time passwords as described in RFC 6238, from either a
+ * base32 seed or an `otpauth://totp/...` URI as exported by most
+ * authenticator apps.
+ */
+
+type Config struct {
+	Secret    []byte
+	Digits    int
+	Period    int
+	Algorithm string
+}
+
+func DefaultConfig() Config {
+	return Config{Digits: 6, Period: 30, Algorithm: "SHA1"}
+}
+
+func DecodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "=", "").Replace(secret))
+	data, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return nil, errors.New("seed is not valid base32")
+	}
+	if len(data) == 0 {
+		return nil, errors.New("seed is empty")
+	}
+	return data, nil
+}
+
+// Parse reads a base32 seed or an otpauth URI, using the defaults for
+// anything the URI does not specify.
+func Parse(value string) (Config, error) {
+	config := DefaultConfig()
+	value = strings.TrimSpace(value)
+
+	if !strings.HasPrefix(value, "otpauth://") {
+		secret, err := DecodeSecret(value)
+		config.Secret = secret
+		return config, err
+	}
+
+	uri, err := url.Parse(value)
+	if err != nil {
+		return config, fmt.Errorf("invalid otpauth URI: %w", err)
+	}
+	if uri.Host != "totp" {
+		return config, fmt.Errorf("unsupported otpauth type: %s", uri.Host)
+	}
+	query := uri.Query()
+	if config.Secret, err = DecodeSecret(query.Get("secret")); err != nil {
+		return config, err
+	}
+	if algorithm := query.Get("algorithm"); algorithm != "" {
+		config.Algorithm = strings.ToUpper(algorithm)
+	}
+	for name, target := range map[string]*int{"digits": &config.Digits, "period": &config.Period} {
+		if text := query.Get(name); text != "" {
+			n, err := strconv.Atoi(text)
+			if err != nil {
+				return config, fmt.Errorf("invalid %s: %s", name, text)
+			}
+			*target = n
+		}
+	}
+	return config, config.Validate()
+}
+
+func (c Config) Validate() error {
+	if c.Digits < 6 || c.Digits > 10 {
+		return fmt.Errorf("digits must be between 6 and 10, got %d", c.Digits)
+	}
+	if c.Period <= 0 {
+		return fmt.Errorf("period must be positive, got %d", c.Period)
+	}
+	if _, err := newHash(c.Algorithm); err != nil {
+		return err
+	}
+	return nil
+}
+
+func newHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToUpper(algorithm) {
+	case "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+}
+
+func (c Config) Code(t time.Time) (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+	newHash, _ := newHash(c.Algorithm)
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/int64(c.Period)))
+	mac := hmac.New(newHash, c.Secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	code := uint64(binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff)
+	modulo := uint64(1)
+	for i := 0; i < c.Digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", c.Digits, code%modulo), nil
+}
+
+// Remaining returns how long the code for t stays valid.
+func (c Config) Remaining(t time.Time) time.Duration {
+	period := int64(c.Period)
+	return time.Duration(period-t.Unix()%period) * time.Second
+}
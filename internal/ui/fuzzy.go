@@ -0,0 +1,52 @@
+package ui
+
+import (
+	"sort"
+	"strings"
+)
+
+// fuzzyScore matches the query as a subsequence of the key, favoring
+// consecutive characters and matches at the start of path segments.
+func fuzzyScore(key string, query string) (int, bool) {
+	key = strings.ToLower(key)
+	query = strings.ToLower(query)
+	score := 0
+	last := -2
+	j := 0
+	for i := 0; i < len(key) && j < len(query); i++ {
+		if key[i] != query[j] {
+			continue
+		}
+		score++
+		if i == last+1 {
+			score += 2
+		}
+		if i == 0 || key[i-1] == '/' || key[i-1] == '-' || key[i-1] == '_' {
+			score += 3
+		}
+		last = i
+		j++
+	}
+	return score, j == len(query)
+}
+
+func fuzzyFilter(keys []string, query string) []string {
+	type match struct {
+		key   string
+		score int
+	}
+	var matches []match
+	for _, key := range keys {
+		if score, ok := fuzzyScore(key, query); ok {
+			matches = append(matches, match{key, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	result := make([]string, len(matches))
+	for i, m := range matches {
+		result[i] = m.key
+	}
+	return result
+}
@@ -0,0 +1,123 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+type terminal struct {
+	saved string
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	return strings.TrimSpace(string(output)), err
+}
+
+func openTerminal() (*terminal, error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, errors.New("the UI requires an interactive terminal")
+	}
+	t := &terminal{saved: saved}
+	if err := t.enter(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *terminal) enter() error {
+	if _, err := stty("raw", "-echo"); err != nil {
+		return err
+	}
+	// Alternate screen, hidden cursor
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	return nil
+}
+
+func (t *terminal) leave() {
+	fmt.Print("\x1b[?25h\x1b[?1049l")
+	stty(t.saved)
+}
+
+func (t *terminal) size() (int, int) {
+	output, err := stty("size")
+	var rows, cols int
+	if err == nil {
+		fmt.Sscanf(output, "%d %d", &rows, &cols)
+	}
+	if rows <= 0 || cols <= 0 {
+		return 24, 80
+	}
+	return rows, cols
+}
+
+const (
+	keyUp = iota + 256
+	keyDown
+	keyLeft
+	keyRight
+	keyPageUp
+	keyPageDown
+	keyEnter
+	keyEscape
+	keyBackspace
+	keyCtrlC
+)
+
+func readKey(input []byte) (int, []byte) {
+	if len(input) == 0 {
+		return 0, input
+	}
+	if input[0] == 0x1b {
+		if len(input) >= 3 && input[1] == '[' {
+			switch input[2] {
+			case 'A':
+				return keyUp, input[3:]
+			case 'B':
+				return keyDown, input[3:]
+			case 'C':
+				return keyRight, input[3:]
+			case 'D':
+				return keyLeft, input[3:]
+			case '5', '6':
+				if len(input) >= 4 && input[3] == '~' {
+					if input[2] == '5' {
+						return keyPageUp, input[4:]
+					}
+					return keyPageDown, input[4:]
+				}
+			}
+			return 0, input[3:]
+		}
+		return keyEscape, input[1:]
+	}
+	switch input[0] {
+	case '\r', '\n':
+		return keyEnter, input[1:]
+	case 127, 8:
+		return keyBackspace, input[1:]
+	case 3:
+		return keyCtrlC, input[1:]
+	}
+	return int(input[0]), input[1:]
+}
+
+func truncate(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	runes := []rune(text)
+	if len(runes) > width {
+		if width == 1 {
+			return "…"
+		}
+		return string(runes[:width-1]) + "…"
+	}
+	return text + strings.Repeat(" ", width-len(runes))
+}
@@ -0,0 +1,462 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"denv/internal/env"
+)
+
+/*
+ * A full-screen browser for keys:
+ *
+ * - the tree of keys grouped by `/` on the left
+ * - the decrypted value of the selected key on the right, masked until revealed
+ */
+
+const help = "↑↓ move  ←→ fold  / search  r reveal  e edit  n rename  c copy  d delete  q quit"
+
+const mask = "********"
+
+type Actions struct {
+	// Edit runs with the terminal restored, e.g. to open an editor
+	Edit func(key string) error
+}
+
+type node struct {
+	name     string
+	path     string
+	isKey    bool
+	children map[string]*node
+}
+
+type row struct {
+	label string
+	key   string
+	dir   string
+}
+
+type inputState struct {
+	prompt string
+	value  []byte
+	submit func(value string)
+	change func(value string)
+}
+
+type model struct {
+	env      *env.DynamicEnv
+	actions  Actions
+	keys     []string
+	expanded map[string]bool
+	rows     []row
+	cursor   int
+	offset   int
+	query    string
+	reveal   bool
+	status   string
+	input    *inputState
+	cache    map[string]*env.DynamicEnvValue
+	errors   map[string]error
+	quit     bool
+}
+
+func Run(envManager *env.DynamicEnv, actions Actions) error {
+	m := &model{
+		env:      envManager,
+		actions:  actions,
+		expanded: make(map[string]bool),
+	}
+	if err := m.reload(); err != nil {
+		return err
+	}
+
+	term, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	defer term.leave()
+
+	// Stdin is only read on request, so that nothing is read from it while
+	// the editor runs
+	requests := make(chan struct{})
+	defer close(requests)
+	keys := make(chan []byte)
+	go func() {
+		buf := make([]byte, 256)
+		for range requests {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- append([]byte{}, buf[:n]...)
+		}
+	}()
+
+	for !m.quit {
+		rows, cols := term.size()
+		m.render(rows, cols)
+		requests <- struct{}{}
+		input, ok := <-keys
+		if !ok {
+			return nil
+		}
+		for len(input) > 0 {
+			var key int
+			key, input = readKey(input)
+			if edit := m.handleKey(key, rows); edit != "" {
+				term.leave()
+				if err := m.actions.Edit(edit); err != nil {
+					m.status = err.Error()
+				}
+				term.enter()
+				delete(m.cache, edit)
+				m.reload()
+			}
+		}
+	}
+	return nil
+}
+
+func (m *model) reload() error {
+	m.env.Reload()
+	keys, err := m.env.ListEnvs()
+	if err != nil {
+		return err
+	}
+	sort.Strings(keys)
+	m.keys = keys
+	m.cache = make(map[string]*env.DynamicEnvValue)
+	m.errors = make(map[string]error)
+	m.buildRows()
+	return nil
+}
+
+func (m *model) buildTree() *node {
+	root := &node{children: make(map[string]*node)}
+	for _, key := range m.keys {
+		current := root
+		parts := strings.Split(key, "/")
+		for i, part := range parts {
+			child, ok := current.children[part]
+			if !ok {
+				child = &node{name: part, path: strings.Join(parts[:i+1], "/"), children: make(map[string]*node)}
+				current.children[part] = child
+			}
+			current = child
+		}
+		current.isKey = true
+	}
+	return root
+}
+
+func (m *model) flatten(n *node, depth int) {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	indent := strings.Repeat("  ", depth)
+	for _, name := range names {
+		child := n.children[name]
+		if len(child.children) > 0 {
+			marker := "▸ "
+			if m.expanded[child.path] {
+				marker = "▾ "
+			}
+			m.rows = append(m.rows, row{label: indent + marker + name + "/", dir: child.path})
+			if m.expanded[child.path] {
+				m.flatten(child, depth+1)
+			}
+		}
+		if child.isKey {
+			m.rows = append(m.rows, row{label: indent + "  " + name, key: child.path})
+		}
+	}
+}
+
+func (m *model) buildRows() {
+	m.rows = nil
+	if m.query != "" {
+		for _, key := range fuzzyFilter(m.keys, m.query) {
+			m.rows = append(m.rows, row{label: key, key: key})
+		}
+	} else {
+		m.flatten(m.buildTree(), 0)
+	}
+	if m.cursor >= len(m.rows) {
+		m.cursor = len(m.rows) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+}
+
+func (m *model) selected() *row {
+	if m.cursor < len(m.rows) {
+		return &m.rows[m.cursor]
+	}
+	return nil
+}
+
+func (m *model) value(key string) (*env.DynamicEnvValue, error) {
+	if value, ok := m.cache[key]; ok {
+		return value, nil
+	}
+	if err, ok := m.errors[key]; ok {
+		return nil, err
+	}
+	value, err := m.env.GetEnv(key)
+	if err != nil {
+		m.errors[key] = err
+		return nil, err
+	}
+	m.cache[key] = value
+	return value, nil
+}
+
+func (m *model) ask(prompt string, initial string, submit func(value string)) {
+	m.input = &inputState{prompt: prompt, value: []byte(initial), submit: submit}
+}
+
+func (m *model) handleInput(key int) {
+	switch key {
+	case keyEnter:
+		input := m.input
+		m.input = nil
+		input.submit(string(input.value))
+	case keyEscape, keyCtrlC:
+		if m.input.change != nil {
+			m.input.change("")
+		}
+		m.input = nil
+		return
+	case keyBackspace:
+		if len(m.input.value) > 0 {
+			m.input.value = m.input.value[:len(m.input.value)-1]
+		}
+	default:
+		if key >= 32 && key < 256 {
+			m.input.value = append(m.input.value, byte(key))
+		}
+	}
+	if m.input != nil && m.input.change != nil {
+		m.input.change(string(m.input.value))
+	}
+}
+
+func (m *model) keyExists(key string) bool {
+	for _, existing := range m.keys {
+		if existing == key {
+			return true
+		}
+	}
+	return false
+}
+
+// handleKey returns the key to edit when the editor has to be opened.
+func (m *model) handleKey(key int, rows int) string {
+	if m.input != nil {
+		m.handleInput(key)
+		return ""
+	}
+
+	m.status = ""
+	page := rows - 4
+	current := m.selected()
+	switch key {
+	case 'q', keyCtrlC:
+		m.quit = true
+	case keyUp, 'k':
+		m.cursor--
+	case keyDown, 'j':
+		m.cursor++
+	case keyPageUp:
+		m.cursor -= page
+	case keyPageDown:
+		m.cursor += page
+	case keyRight, 'l', keyEnter:
+		if current != nil && current.dir != "" {
+			m.expanded[current.dir] = true
+			m.buildRows()
+		}
+	case keyLeft, 'h':
+		if current != nil && current.dir != "" && m.expanded[current.dir] {
+			delete(m.expanded, current.dir)
+			m.buildRows()
+		}
+	case keyEscape:
+		m.query = ""
+		m.buildRows()
+	case '/':
+		m.query = ""
+		m.buildRows()
+		search := func(value string) {
+			m.query = value
+			m.cursor = 0
+			m.buildRows()
+		}
+		m.ask("Search: ", "", search)
+		m.input.change = search
+	case 'r':
+		m.reveal = !m.reveal
+	case 'e':
+		if current != nil && current.key != "" {
+			return current.key
+		}
+	case 'n':
+		if current != nil && current.key != "" {
+			from := current.key
+			m.ask("Rename to: ", from, func(to string) {
+				m.status = m.rename(from, to)
+			})
+		}
+	case 'c':
+		if current != nil && current.key != "" {
+			from := current.key
+			m.ask("Copy to: ", from, func(to string) {
+				if to == from || to == "" || m.keyExists(to) {
+					m.status = "Key already exists: " + to
+					return
+				}
+				if err := m.env.CopyEnv(from, to, false); err != nil {
+					m.status = err.Error()
+					return
+				}
+				m.status = "Copied " + from + " to " + to
+				m.reload()
+			})
+		}
+	case 'd':
+		if current != nil && current.key != "" {
+			target := current.key
+			m.ask("Delete "+target+"? (y/N) ", "", func(answer string) {
+				if answer != "y" && answer != "yes" {
+					return
+				}
+				if err := m.env.DeleteEnv(target); err != nil {
+					m.status = err.Error()
+					return
+				}
+				m.status = "Deleted " + target
+				m.reload()
+			})
+		}
+	}
+
+	if m.cursor >= len(m.rows) {
+		m.cursor = len(m.rows) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+	return ""
+}
+
+func (m *model) rename(from string, to string) string {
+	if to == from || to == "" {
+		return ""
+	}
+	if err := m.env.RenameEnv(from, to); err != nil {
+		return err.Error()
+	}
+	m.reload()
+	return "Renamed " + from + " to " + to
+}
+
+func (m *model) detailLines(key string) []string {
+	value, err := m.value(key)
+	if err != nil {
+		return []string{"Error: " + err.Error()}
+	}
+
+	lines := []string{"id: " + value.Metadata.ID}
+	if len(value.Metadata.Secret) > 0 {
+		lines = append(lines, "secret: "+strings.Join(value.Metadata.Secret, ", "))
+	}
+	if extends, ok := value.Data["extends"].([]any); ok {
+		lines = append(lines, "", "extends:")
+		for _, dep := range extends {
+			lines = append(lines, fmt.Sprintf("  → %v", dep))
+		}
+	}
+	for _, section := range []string{"local", "env", "files"} {
+		values, ok := value.Data[section].(map[string]any)
+		if !ok {
+			continue
+		}
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		lines = append(lines, "", section+":")
+		for _, name := range names {
+			shown := mask
+			if m.reveal {
+				shown = strings.ReplaceAll(fmt.Sprintf("%v", values[name]), "\n", "⏎")
+			}
+			lines = append(lines, fmt.Sprintf("  %s = %s", name, shown))
+		}
+	}
+	if value.Payload != "" {
+		lines = append(lines, "", fmt.Sprintf("payload: %d bytes", len(value.Payload)))
+	}
+	return lines
+}
+
+func (m *model) render(rows int, cols int) {
+	var screen strings.Builder
+	screen.WriteString("\x1b[H")
+
+	listHeight := rows - 3
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+listHeight {
+		m.offset = m.cursor - listHeight + 1
+	}
+
+	leftWidth := cols * 2 / 5
+	rightWidth := cols - leftWidth - 3
+
+	title := fmt.Sprintf(" denv: %d keys", len(m.keys))
+	if m.query != "" {
+		title += fmt.Sprintf(", %d matching %q", len(m.rows), m.query)
+	}
+	screen.WriteString("\x1b[7m" + truncate(title, cols) + "\x1b[0m\r\n")
+
+	var details []string
+	if current := m.selected(); current != nil && current.key != "" {
+		details = m.detailLines(current.key)
+	}
+
+	for i := 0; i < listHeight; i++ {
+		left := ""
+		index := m.offset + i
+		if index < len(m.rows) {
+			left = m.rows[index].label
+		}
+		left = truncate(" "+left, leftWidth)
+		if index == m.cursor && index < len(m.rows) {
+			left = "\x1b[7m" + left + "\x1b[0m"
+		}
+		right := ""
+		if i < len(details) {
+			right = details[i]
+		}
+		screen.WriteString(left + " │ " + truncate(right, rightWidth) + "\r\n")
+	}
+
+	footer := m.status
+	if m.input != nil {
+		footer = m.input.prompt + string(m.input.value) + "█"
+	}
+	screen.WriteString(truncate(footer, cols) + "\r\n")
+	screen.WriteString("\x1b[2m" + truncate(help, cols) + "\x1b[0m")
+	screen.WriteString("\x1b[J")
+	os.Stdout.WriteString(screen.String())
+}